@@ -0,0 +1,92 @@
+package app
+
+import (
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/k8s"
+	"github.com/mathspanda/ws-operator-demo/pkg/operator"
+)
+
+var (
+	crdKubeConfig    string
+	crdOutput        string
+	uninstallForce   bool
+	uninstallTimeout time.Duration
+)
+
+var crdCmd = &cobra.Command{
+	Use:   "crd",
+	Short: "Manage WebServerCluster crd",
+}
+
+var crdInstallCmd = &cobra.Command{
+	Use:           "install",
+	Short:         "Install WebServerCluster crd, an installed crd is left as it is",
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := operator.NewCRDManager(crdKubeConfig)
+		if err != nil {
+			return err
+		}
+		return manager.Install()
+	},
+}
+
+var crdUpgradeCmd = &cobra.Command{
+	Use:           "upgrade",
+	Short:         "Upgrade installed WebServerCluster crd to this version, or install it",
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := operator.NewCRDManager(crdKubeConfig)
+		if err != nil {
+			return err
+		}
+		return manager.Upgrade()
+	},
+}
+
+var crdUninstallCmd = &cobra.Command{
+	Use:           "uninstall",
+	Short:         "Uninstall WebServerCluster crd, which is refused while WebServerClusters exist unless forced",
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := operator.NewCRDManager(crdKubeConfig)
+		if err != nil {
+			return err
+		}
+		return manager.Uninstall(uninstallForce, uninstallTimeout)
+	},
+}
+
+var crdPrintCmd = &cobra.Command{
+	Use:           "print",
+	Short:         "Print WebServerCluster crd without contacting the cluster",
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkOutput(crdOutput); err != nil {
+			return err
+		}
+		crd := k8s.MakeCRDConfig(k8s.NewCRDData(operator.NewWebServerClusterCRD()))
+		return printObject(os.Stdout, crd, crdOutput, true)
+	},
+}
+
+func init() {
+	crdCmd.PersistentFlags().StringVarP(&crdKubeConfig, "kubeconfig", "c", "", "path to kube config")
+
+	crdUninstallCmd.Flags().BoolVar(&uninstallForce, "force", false,
+		"delete WebServerClusters before uninstalling crd, their finalizers are run by operator")
+	crdUninstallCmd.Flags().DurationVar(&uninstallTimeout, "timeout", 5*time.Minute,
+		"duration to wait for WebServerClusters to be deleted with force")
+	crdPrintCmd.Flags().StringVarP(&crdOutput, "output", "o", "yaml", "output format, yaml or json")
+
+	crdCmd.AddCommand(crdInstallCmd, crdUpgradeCmd, crdUninstallCmd, crdPrintCmd)
+	rootCmd.AddCommand(crdCmd)
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+	"github.com/mathspanda/ws-operator-demo/pkg/controller"
+	"github.com/mathspanda/ws-operator-demo/pkg/operator"
+)
+
+var (
+	renderFile   string
+	renderOutput string
+)
+
+var renderCmd = &cobra.Command{
+	Use:           "render",
+	Short:         "Print deployments and services which operator creates for WebServerClusters in a file",
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if renderFile == "" {
+			return fmt.Errorf("file is required")
+		}
+		if err := checkOutput(renderOutput); err != nil {
+			return err
+		}
+
+		var in io.Reader = os.Stdin
+		if renderFile != "-" {
+			f, err := os.Open(renderFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		return render(in, os.Stdout)
+	},
+}
+
+// render prints the deployment and service of each WebServerCluster decoded from in.
+func render(in io.Reader, out io.Writer) error {
+	crd := operator.NewWebServerClusterCRD()
+	defaults := newDefaults()
+	decoder := utilyaml.NewYAMLOrJSONDecoder(in, 4096)
+	first := true
+	for {
+		ws := &v1.WebServerCluster{}
+		if err := decoder.Decode(ws); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		// empty yaml document
+		if ws.Kind == "" && ws.Name == "" {
+			continue
+		}
+		if ws.Kind != "" && ws.Kind != crd.Kind {
+			return fmt.Errorf("expect kind %s, got %s", crd.Kind, ws.Kind)
+		}
+
+		deploy, svc, err := controller.Render(crd, defaults, ws)
+		if err != nil {
+			return fmt.Errorf("failed to render WebServerCluster %s: %v", ws.Name, err)
+		}
+		for _, obj := range []interface{}{deploy, svc} {
+			if err := printObject(out, obj, renderOutput, first); err != nil {
+				return err
+			}
+			first = false
+		}
+	}
+}
+
+func checkOutput(output string) error {
+	if output != "yaml" && output != "json" {
+		return fmt.Errorf("output must be yaml or json, got %s", output)
+	}
+	return nil
+}
+
+// printObject prints obj as a yaml document in yaml output, or as an indented json object.
+func printObject(out io.Writer, obj interface{}, output string, first bool) error {
+	if output == "json" {
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	}
+
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if !first {
+		if _, err := fmt.Fprintln(out, "---"); err != nil {
+			return err
+		}
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+func init() {
+	renderCmd.Flags().StringVarP(&renderFile, "file", "f", "",
+		"yaml or json file of WebServerClusters, - means stdin")
+	renderCmd.Flags().StringVarP(&renderOutput, "output", "o", "yaml", "output format, yaml or json")
+	addDefaultsFlags(renderCmd.Flags())
+
+	rootCmd.AddCommand(renderCmd)
+}
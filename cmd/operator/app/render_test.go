@@ -0,0 +1,80 @@
+package app
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+func TestRenderGolden(t *testing.T) {
+	defaultReplicas, defaultImage, defaultPort = 1, "", 0
+	defer func() { renderOutput = "yaml" }()
+
+	tests := []struct {
+		input  string
+		output string
+	}{
+		{input: "clusterip.yaml", output: "yaml"},
+		{input: "headless.yaml", output: "json"},
+		{input: "nodeport.json", output: "yaml"},
+		{input: "loadbalancer.json", output: "json"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			in, err := os.Open(filepath.Join("testdata", test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+
+			renderOutput = test.output
+			out := &bytes.Buffer{}
+			if err := render(in, out); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata",
+				strings.TrimSuffix(test.input, filepath.Ext(test.input))+".golden."+test.output)
+			if *update {
+				if err := ioutil.WriteFile(golden, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), expected) {
+				t.Fatalf("rendered output differs from %s, run with -update if it is expected:\n%s", golden, out)
+			}
+		})
+	}
+}
+
+func TestRenderInvalid(t *testing.T) {
+	defaultReplicas, defaultImage, defaultPort = 1, "", 0
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "other kind", input: "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"},
+		{name: "no name", input: "kind: WebServerCluster\nspec:\n  image: nginx\n"},
+		{name: "no image", input: "kind: WebServerCluster\nmetadata:\n  name: web\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := render(strings.NewReader(test.input), ioutil.Discard); err == nil {
+				t.Fatal("expect error")
+			}
+		})
+	}
+}
@@ -1,18 +1,69 @@
 package app
 
 import (
-	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
 	"github.com/mathspanda/ws-operator-demo/pkg/operator"
+	"github.com/mathspanda/ws-operator-demo/pkg/webhook"
 )
 
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// flagAliases maps the camelCase names of flags to their kebab-case names.
+var flagAliases = map[string]string{
+	"shardIndex":     "shard-index",
+	"shardCount":     "shard-count",
+	"dryRun":         "dry-run",
+	"skipCRDInstall": "skip-crd-install",
+}
+
 var (
 	kubeConfig     string
-	watchNamespace string
 	resyncSeconds  uint32
+	workers        int
+	metricsAddress string
+	enableDebug    bool
+	stuckTimeout   time.Duration
+
+	shutdownGracePeriod time.Duration
+
+	watchNamespaces   []string
+	namespaceSelector string
+	selector          string
+	shardIndex        int
+	shardCount        int
+
+	dryRun         bool
+	skipCRDInstall bool
+
+	defaultReplicas int32
+	defaultImage    string
+	defaultPort     int32
+
+	enableWebhook           bool
+	webhookPort             int
+	webhookCertFile         string
+	webhookKeyFile          string
+	webhookCAFile           string
+	webhookServiceName      string
+	webhookServiceNamespace string
+	allowedRegistries       []string
+
+	leaderElect              bool
+	leaderElectResourceLock  string
+	leaderElectNamespace     string
+	leaderElectName          string
+	leaderElectLeaseDuration time.Duration
+	leaderElectRenewDeadline time.Duration
+	leaderElectRetryPeriod   time.Duration
 )
 
 var serverCmd = &cobra.Command{
@@ -22,29 +73,199 @@ var serverCmd = &cobra.Command{
 	SilenceUsage:  true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		config := &operator.OperatorConfig{
-			KubeConfigPath: kubeConfig,
-			WatchNamespace: watchNamespace,
-			ResyncPeriod:   time.Duration(resyncSeconds) * time.Second,
+			KubeConfigPath:      kubeConfig,
+			WatchNamespaces:     watchNamespaces,
+			NamespaceSelector:   namespaceSelector,
+			Selector:            selector,
+			ResyncPeriod:        time.Duration(resyncSeconds) * time.Second,
+			Workers:             workers,
+			MetricsAddress:      metricsAddress,
+			EnableDebug:         enableDebug,
+			WorkerStuckTimeout:  stuckTimeout,
+			ShutdownGracePeriod: shutdownGracePeriod,
+			DryRun:              dryRun,
+			SkipCRDInstall:      skipCRDInstall,
+			Defaults:            newDefaults(),
+		}
+		if enableWebhook {
+			config.Webhook = &webhook.Config{
+				Port:              webhookPort,
+				CertFile:          webhookCertFile,
+				KeyFile:           webhookKeyFile,
+				CAFile:            webhookCAFile,
+				ServiceName:       webhookServiceName,
+				ServiceNamespace:  webhookServiceNamespace,
+				AllowedRegistries: allowedRegistries,
+				Defaults:          config.Defaults,
+			}
+		}
+		if leaderElect {
+			namespace := leaderElectNamespace
+			if namespace == "" {
+				var err error
+				if namespace, err = podNamespace(); err != nil {
+					return err
+				}
+			}
+			config.LeaderElection = &operator.LeaderElectionConfig{
+				ResourceLock:  leaderElectResourceLock,
+				Namespace:     namespace,
+				Name:          leaderElectName,
+				LeaseDuration: leaderElectLeaseDuration,
+				RenewDeadline: leaderElectRenewDeadline,
+				RetryPeriod:   leaderElectRetryPeriod,
+			}
 		}
 
-		operator, err := operator.NewOperator(config)
+		shard, err := newShardConfig(cmd.Flags())
 		if err != nil {
 			return err
 		}
+		config.Shard = shard
+
+		if workers < 1 {
+			return fmt.Errorf("workers must be positive, got %d", workers)
+		}
 
-		ctx := context.TODO()
-		stopCh := make(chan struct{})
+		operator, err := operator.NewOperator(config)
+		if err != nil {
+			return err
+		}
 
-		return operator.Run(ctx, stopCh)
+		return operator.Run(newSignalContext())
 	},
 }
 
 func init() {
+	serverCmd.SetGlobalNormalizationFunc(normalizeFlagAliases)
+
 	serverCmd.Flags().StringVarP(&kubeConfig, "kubeconfig", "c", "", "path to kube config")
-	serverCmd.Flags().StringVarP(&watchNamespace, "watchNamespace", "n", "",
-		"namespace which operator watches")
+	serverCmd.Flags().StringSliceVarP(&watchNamespaces, "watchNamespace", "n", nil,
+		"comma separated namespaces which operator watches, empty means all namespaces; "+
+			"more than one namespace is watched cluster-wide and filtered by operator, which needs cluster-wide rbac")
+	serverCmd.Flags().StringVar(&namespaceSelector, "namespaceSelector", "",
+		"label selector of namespaces which operator watches, e.g. ws-operator=enabled, "+
+			"namespaces gaining or losing the labels are watched or released at runtime")
+	serverCmd.Flags().StringVar(&selector, "selector", "",
+		"label selector of WebServerClusters which operator serves, empty means all")
+	serverCmd.Flags().IntVar(&shardIndex, "shard-index", 0,
+		"index of the shard which operator serves, in [0, shard-count)")
+	serverCmd.Flags().IntVar(&shardCount, "shard-count", 0,
+		"number of shards WebServerClusters are split into by the hash of namespace/name, 0 means no sharding")
 	serverCmd.Flags().Uint32Var(&resyncSeconds, "resyncSeconds", 30,
 		"resync seconds")
+	serverCmd.Flags().IntVar(&workers, "workers", 2,
+		"number of workers reconciling WebServerClusters concurrently")
+	serverCmd.Flags().StringVar(&metricsAddress, "metricsAddress", ":8080",
+		"address to serve prometheus metrics on /metrics and probes on /healthz and /readyz, empty means disabled")
+	serverCmd.Flags().BoolVar(&enableDebug, "enableDebug", false,
+		"serve pprof, informer stores and queue contents on /debug of metricsAddress")
+	serverCmd.Flags().DurationVar(&stuckTimeout, "workerStuckTimeout", 5*time.Minute,
+		"/healthz fails if a worker reconciles a WebServerCluster longer than it")
+	serverCmd.Flags().DurationVar(&shutdownGracePeriod, "shutdownGracePeriod", 20*time.Second,
+		"duration to wait for in-flight WebServerClusters to be reconciled on SIGINT or SIGTERM")
+
+	serverCmd.Flags().BoolVar(&dryRun, "dry-run", false,
+		"log planned creates, updates and deletes and serve them on /plan of metricsAddress without writing anything, "+
+			"leader election and admission webhook are disabled")
+
+	serverCmd.Flags().BoolVar(&skipCRDInstall, "skip-crd-install", false,
+		"don't create crd but wait for the one installed by `crd install` to be established, "+
+			"so that operator needs no rights to write crds")
+
+	addDefaultsFlags(serverCmd.Flags())
+
+	serverCmd.Flags().BoolVar(&enableWebhook, "enableWebhook", false,
+		"serve validating and mutating admission webhooks for WebServerCluster")
+	serverCmd.Flags().IntVar(&webhookPort, "webhookPort", 8443, "port of admission webhook server")
+	serverCmd.Flags().StringVar(&webhookCertFile, "webhookCertFile", "/etc/webhook/certs/tls.crt",
+		"path to TLS certificate of admission webhook server")
+	serverCmd.Flags().StringVar(&webhookKeyFile, "webhookKeyFile", "/etc/webhook/certs/tls.key",
+		"path to TLS private key of admission webhook server")
+	serverCmd.Flags().StringVar(&webhookCAFile, "webhookCAFile", "/etc/webhook/certs/ca.crt",
+		"path to CA bundle which signs the admission webhook certificate")
+	serverCmd.Flags().StringVar(&webhookServiceName, "webhookServiceName", "ws-operator-demo-webhook",
+		"name of service which exposes admission webhook server")
+	serverCmd.Flags().StringVar(&webhookServiceNamespace, "webhookServiceNamespace", "default",
+		"namespace of service which exposes admission webhook server")
+	serverCmd.Flags().StringSliceVar(&allowedRegistries, "allowedRegistries", nil,
+		"registries WebServerCluster images are allowed to be pulled from, empty means no restriction")
+
+	serverCmd.Flags().BoolVar(&leaderElect, "leaderElect", false,
+		"run leader election among operator replicas, only the leader reconciles WebServerClusters")
+	serverCmd.Flags().StringVar(&leaderElectResourceLock, "leaderElectResourceLock", "configmaps",
+		"type of leader election lock object, configmaps or leases (kubernetes 1.14+)")
+	serverCmd.Flags().StringVar(&leaderElectNamespace, "leaderElectNamespace", "",
+		"namespace of leader election lock object, defaults to the namespace of operator pod")
+	serverCmd.Flags().StringVar(&leaderElectName, "leaderElectName", "ws-operator-demo",
+		"name of leader election lock object")
+	serverCmd.Flags().DurationVar(&leaderElectLeaseDuration, "leaderElectLeaseDuration", 15*time.Second,
+		"duration that standby replicas wait before taking over an unrenewed leadership")
+	serverCmd.Flags().DurationVar(&leaderElectRenewDeadline, "leaderElectRenewDeadline", 10*time.Second,
+		"duration that the leader retries renewing before giving up the leadership")
+	serverCmd.Flags().DurationVar(&leaderElectRetryPeriod, "leaderElectRetryPeriod", 2*time.Second,
+		"interval of acquiring and renewing leadership")
 
 	rootCmd.AddCommand(serverCmd)
 }
+
+// newShardConfig returns the shard which operator serves, or nil if sharding is disabled.
+func newShardConfig(flags *pflag.FlagSet) (*operator.ShardConfig, error) {
+	if shardCount < 0 {
+		return nil, fmt.Errorf("shard-count must not be negative, got %d", shardCount)
+	}
+	if shardCount == 0 {
+		if flags.Changed("shard-index") {
+			return nil, fmt.Errorf("shard-index is set without shard-count")
+		}
+		return nil, nil
+	}
+	if shardIndex < 0 || shardIndex >= shardCount {
+		return nil, fmt.Errorf("shard-index must be in [0, %d), got %d", shardCount, shardIndex)
+	}
+	return &operator.ShardConfig{
+		Index: shardIndex,
+		Count: shardCount,
+	}, nil
+}
+
+// normalizeFlagAliases maps the former camelCase names of flags to their kebab-case names,
+// so that both names work.
+func normalizeFlagAliases(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if alias, ok := flagAliases[name]; ok {
+		name = alias
+	}
+	return pflag.NormalizedName(name)
+}
+
+// podNamespace returns the namespace of operator pod, from POD_NAMESPACE set by the downward api
+// or the namespace file of the mounted service account.
+func podNamespace() (string, error) {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace, nil
+	}
+	data, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return "", fmt.Errorf("leaderElectNamespace is required out of cluster: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// addDefaultsFlags adds the flags of WebServerCluster defaults, shared by commands building WebServerClusters.
+func addDefaultsFlags(flags *pflag.FlagSet) {
+	flags.Int32Var(&defaultReplicas, "defaultReplicas", 1,
+		"replicas of the deployment created for WebServerCluster if unspecified, which are not written to "+
+			"WebServerCluster so that the deployment can be scaled by HPA, 0 means the kubernetes default")
+	flags.StringVar(&defaultImage, "defaultImage", "",
+		"image of WebServerCluster if unspecified, empty means no default")
+	flags.Int32Var(&defaultPort, "defaultPort", 0,
+		"service port of WebServerCluster if unspecified, 0 means no default")
+}
+
+func newDefaults() *v1.WebServerClusterDefaults {
+	return &v1.WebServerClusterDefaults{
+		Replicas:    defaultReplicas,
+		Image:       defaultImage,
+		ServicePort: defaultPort,
+	}
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// newSignalContext returns a context which is canceled on SIGINT or SIGTERM.
+// A second signal exits directly.
+func newSignalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		log.Infof("Receive signal %v, begin to shut down.", sig)
+		cancel()
+		sig = <-sigCh
+		log.Errorf("Receive signal %v again, exit directly.", sig)
+		os.Exit(1)
+	}()
+
+	return ctx
+}
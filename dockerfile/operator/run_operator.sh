@@ -4,9 +4,46 @@ if [ -z ${DEBUG_LEVEL} ]; then
     DEBUG_LEVEL=5
 fi
 
-cmd="/app/operator server -l ${DEBUG_LEVEL} -n ${WATCH_NAMESPACE}
-    --resyncSeconds ${RESYNC_SECONDS}
+cmd="/app/operator server -l ${DEBUG_LEVEL} --watchNamespace='${WATCH_NAMESPACE}'
+    --namespaceSelector='${NAMESPACE_SELECTOR}' --selector='${SELECTOR}'
+    --resyncSeconds ${RESYNC_SECONDS} --workers ${WORKERS:-2}
+    --metricsAddress :${METRICS_PORT:-8080} --shutdownGracePeriod ${SHUTDOWN_GRACE_PERIOD:-20s}
+    --defaultReplicas ${DEFAULT_REPLICAS:-1} --defaultImage=${DEFAULT_IMAGE} --defaultPort ${DEFAULT_PORT:-0}
 "
 
+if [ "${SHARD_COUNT:-0}" != "0" ]; then
+    cmd="${cmd} --shard-index ${SHARD_INDEX:-0} --shard-count ${SHARD_COUNT}"
+fi
+
+if [ "${SKIP_CRD_INSTALL}" = "true" ]; then
+    cmd="${cmd} --skip-crd-install"
+fi
+
+if [ "${DRY_RUN}" = "true" ]; then
+    cmd="${cmd} --dry-run"
+fi
+
+if [ "${DEBUG_ENABLED}" = "true" ]; then
+    cmd="${cmd} --enableDebug"
+fi
+
+if [ "${WEBHOOK_ENABLED}" = "true" ]; then
+    cmd="${cmd} --enableWebhook --webhookPort ${WEBHOOK_PORT}
+    --webhookServiceName ${WEBHOOK_SERVICE_NAME}
+    --webhookServiceNamespace ${WEBHOOK_SERVICE_NAMESPACE}
+    --allowedRegistries=${ALLOWED_REGISTRIES}
+"
+fi
+
+if [ "${LEADER_ELECT}" = "true" ]; then
+    cmd="${cmd} --leaderElect --leaderElectResourceLock ${LEADER_ELECT_RESOURCE_LOCK}
+    --leaderElectName ${LEADER_ELECT_NAME}
+    --leaderElectLeaseDuration ${LEADER_ELECT_LEASE_DURATION}
+    --leaderElectRenewDeadline ${LEADER_ELECT_RENEW_DEADLINE}
+    --leaderElectRetryPeriod ${LEADER_ELECT_RETRY_PERIOD}
+"
+fi
+
 echo "command: " ${cmd}
-eval ${cmd}
+# exec so that operator receives SIGTERM and shuts down gracefully
+eval exec ${cmd}
@@ -0,0 +1,44 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func NewCondition(condType WebServerClusterConditionType, status ConditionStatus,
+	reason, message string) WebServerClusterCondition {
+	return WebServerClusterCondition{
+		Type:               condType,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+func GetCondition(status *WebServerClusterStatus, condType WebServerClusterConditionType) *WebServerClusterCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == condType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the same type,
+// lastTransitionTime is kept if the condition status does not change.
+func SetCondition(status *WebServerClusterStatus, cond WebServerClusterCondition) {
+	current := GetCondition(status, cond.Type)
+	if current == nil {
+		status.Conditions = append(status.Conditions, cond)
+		return
+	}
+	if current.Status == cond.Status {
+		cond.LastTransitionTime = current.LastTransitionTime
+	}
+	*current = cond
+}
+
+func IsConditionTrue(status *WebServerClusterStatus, condType WebServerClusterConditionType) bool {
+	cond := GetCondition(status, condType)
+	return cond != nil && cond.Status == ConditionTrue
+}
@@ -0,0 +1,29 @@
+package v1
+
+// WebServerClusterDefaults holds the values set on unspecified spec fields.
+// Zero values mean no default for the field.
+type WebServerClusterDefaults struct {
+	// Replicas is not set on spec but only on created deployments, so that deployments of
+	// WebServerClusters without replicas can be scaled by others, e.g. HPA.
+	Replicas    int32
+	Image       string
+	ServicePort int32
+}
+
+// SetDefaults sets the unspecified fields of spec, and returns whether spec is changed.
+func SetDefaults(spec *WebServerClusterSpec, defaults *WebServerClusterDefaults) bool {
+	if defaults == nil {
+		return false
+	}
+
+	changed := false
+	if spec.Image == "" && defaults.Image != "" {
+		spec.Image = defaults.Image
+		changed = true
+	}
+	if spec.ServicePort == 0 && defaults.ServicePort != 0 {
+		spec.ServicePort = defaults.ServicePort
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,64 @@
+package v1
+
+// ServiceType returns the type of the cluster service.
+func (spec *WebServerClusterSpec) ServiceType() ServiceType {
+	if spec.Service == nil || spec.Service.Type == "" {
+		return ServiceTypeLoadBalancer
+	}
+	return spec.Service.Type
+}
+
+// NodePort returns the node port of the cluster service, 0 means allocated by kubernetes.
+func (spec *WebServerClusterSpec) NodePort() int32 {
+	switch spec.ServiceType() {
+	case ServiceTypeNodePort, ServiceTypeLoadBalancer:
+	default:
+		return 0
+	}
+	if spec.Service != nil && spec.Service.NodePort != 0 {
+		return spec.Service.NodePort
+	}
+	return spec.ServicePort
+}
+
+func (spec *WebServerClusterSpec) GetDeletionPolicy() DeletionPolicy {
+	if spec.DeletionPolicy == "" {
+		return DeletionPolicyDelete
+	}
+	return spec.DeletionPolicy
+}
+
+func (ws *WebServerCluster) HasFinalizer(finalizer string) bool {
+	for _, f := range ws.ObjectMeta.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterPorts returns the ports of web server with unspecified fields filled.
+func (spec *WebServerClusterSpec) ClusterPorts() []WebServerClusterPort {
+	if len(spec.Ports) == 0 {
+		return []WebServerClusterPort{
+			{
+				Name:          "http",
+				ContainerPort: 80,
+				ServicePort:   80,
+				Protocol:      "TCP",
+			},
+		}
+	}
+
+	ports := make([]WebServerClusterPort, len(spec.Ports))
+	for i, port := range spec.Ports {
+		if port.ServicePort == 0 {
+			port.ServicePort = port.ContainerPort
+		}
+		if port.Protocol == "" {
+			port.Protocol = "TCP"
+		}
+		ports[i] = port
+	}
+	return ports
+}
@@ -12,14 +12,108 @@ type WebServerCluster struct {
 	Status WebServerClusterStatus `json:"status"`
 }
 
+// validate tags are used to generate the CRD validation schema
 type WebServerClusterSpec struct {
-	Replicas    *int32 `json:"replicas"`
-	Image       string `json:"image"`
-	ServicePort int32  `json:"port"`
+	Replicas    *int32 `json:"replicas,omitempty" validate:"minimum=0"`
+	Image       string `json:"image,omitempty" validate:"minLength=1,pattern=^[^\\s]+$"`
+	ServicePort int32  `json:"port,omitempty" validate:"minimum=0,maximum=65535"`
+
+	// ports of web server, spec.port is used as node port of the first one,
+	// a single port 80 named http is exposed if unspecified
+	Ports []WebServerClusterPort `json:"ports,omitempty"`
+
+	Service *WebServerClusterServiceSpec `json:"service,omitempty"`
+
+	// what happens to deployment and service when the cluster is deleted, Delete if unspecified
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty" validate:"enum=Delete|Orphan|Retain"`
+}
+
+type DeletionPolicy string
+
+const (
+	// deployment and service are deleted with the cluster
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// deployment and service are detached from the cluster and kept running unmanaged
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+	// deployment and service are kept, and adopted by the cluster of the same name created later
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+)
+
+// finalizer which makes operator clean up deployment and service before cluster is deleted
+const WebServerClusterFinalizer = "demo.io/cleanup"
+
+type WebServerClusterPort struct {
+	Name          string `json:"name,omitempty" validate:"maxLength=15,pattern=^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"`
+	ContainerPort int32  `json:"containerPort" validate:"required,minimum=1,maximum=65535"`
+	// containerPort is used if unspecified
+	ServicePort int32 `json:"servicePort,omitempty" validate:"minimum=1,maximum=65535"`
+	// TCP if unspecified
+	Protocol    string `json:"protocol,omitempty" validate:"enum=TCP|UDP"`
+	AppProtocol string `json:"appProtocol,omitempty"`
+}
+
+type ServiceType string
+
+const (
+	ServiceTypeClusterIP    ServiceType = "ClusterIP"
+	ServiceTypeNodePort     ServiceType = "NodePort"
+	ServiceTypeLoadBalancer ServiceType = "LoadBalancer"
+	// ClusterIP service without cluster ip
+	ServiceTypeHeadless ServiceType = "Headless"
+)
+
+type WebServerClusterServiceSpec struct {
+	// LoadBalancer if unspecified
+	Type ServiceType `json:"type,omitempty" validate:"enum=ClusterIP|NodePort|LoadBalancer|Headless"`
+	// node port of NodePort and LoadBalancer service, spec.port is used if unspecified
+	NodePort                 int32             `json:"nodePort,omitempty" validate:"minimum=0,maximum=65535"`
+	LoadBalancerSourceRanges []string          `json:"loadBalancerSourceRanges,omitempty"`
+	ExternalTrafficPolicy    string            `json:"externalTrafficPolicy,omitempty" validate:"enum=Cluster|Local"`
+	SessionAffinity          string            `json:"sessionAffinity,omitempty" validate:"enum=None|ClientIP"`
+	Annotations              map[string]string `json:"annotations,omitempty"`
 }
 
 type WebServerClusterStatus struct {
-	Replicas int32 `json:"replicas"`
+	// generation of the WebServerCluster spec last handled by operator
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	Replicas          int32 `json:"replicas"`
+	ReadyReplicas     int32 `json:"readyReplicas,omitempty"`
+	UpdatedReplicas   int32 `json:"updatedReplicas,omitempty"`
+	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
+	// label selector of the cluster pods, used by the scale subresource
+	Selector string `json:"selector,omitempty"`
+
+	Conditions []WebServerClusterCondition `json:"conditions,omitempty"`
+}
+
+type WebServerClusterConditionType string
+
+const (
+	// enough replicas of the cluster are available
+	WebServerClusterAvailable WebServerClusterConditionType = "Available"
+	// a rollout of the cluster is in progress
+	WebServerClusterProgressing WebServerClusterConditionType = "Progressing"
+	// the cluster fails to reach its desired state
+	WebServerClusterDegraded WebServerClusterConditionType = "Degraded"
+	// the last reconcile of the cluster failed
+	WebServerClusterReconcileError WebServerClusterConditionType = "ReconcileError"
+)
+
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+type WebServerClusterCondition struct {
+	Type               WebServerClusterConditionType `json:"type"`
+	Status             ConditionStatus               `json:"status"`
+	LastTransitionTime metav1.Time                   `json:"lastTransitionTime,omitempty"`
+	Reason             string                        `json:"reason,omitempty"`
+	Message            string                        `json:"message,omitempty"`
 }
 
 type WebServerClusterList struct {
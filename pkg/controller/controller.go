@@ -2,7 +2,10 @@ package controller
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -12,18 +15,31 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 
 	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
 	"github.com/mathspanda/ws-operator-demo/pkg/k8s"
+	"github.com/mathspanda/ws-operator-demo/pkg/record"
 )
 
 const (
 	maxRetries = 15
+
+	// records the service annotation keys set by operator
+	managedAnnotationsKey = "demo.io/managed-annotations"
+	// records the application protocols of service ports, as name=protocol pairs
+	appProtocolsKey = "demo.io/app-protocols"
+
+	// labels marking the deployments and services created by operator
+	OwnerLabelKey     = "demo.io/webservercluster"
+	ManagedByLabelKey = "app.kubernetes.io/managed-by"
+	ManagedByLabel    = "ws-operator-demo"
 )
 
 type WSControllerConfig struct {
@@ -32,8 +48,16 @@ type WSControllerConfig struct {
 	KubeClient *kubernetes.Clientset
 	Crd        *k8s.CRD
 
-	Namespace    string
-	ResyncPeriod time.Duration
+	// namespace which orphans are swept in, metav1.NamespaceAll for all
+	Namespace string
+	// WebServerClusters are only served in the namespaces it accepts, all if nil
+	NamespaceFilter func(namespace string) bool
+	ResyncPeriod    time.Duration
+	Defaults        *v1.WebServerClusterDefaults
+	// events are not recorded if nil
+	Recorder record.EventRecorder
+	// writes are recorded in the plan instead of sent to api server if set
+	DryRunPlan *k8s.Plan
 }
 
 type WSController struct {
@@ -41,227 +65,457 @@ type WSController struct {
 	aeClient   *apiextensionsclient.Clientset
 	kubeClient *kubernetes.Clientset
 
-	deployI k8s.DeploymentInterface
-	svcI    k8s.ServiceInterface
+	// writes go to api server, while reads go to listers of the informers
+	deployI      k8s.DeploymentInterface
+	svcI         k8s.ServiceInterface
+	deployLister *k8s.DeploymentLister
+	svcLister    *k8s.ServiceLister
 
-	crdI      k8s.CRDInterface
+	crdI k8s.CRDInterface
+	// lazily created and shared by workers, guarded by crdLock
+	crdLock   sync.Mutex
 	crdClient *rest.RESTClient
 	crdScheme *runtime.Scheme
 	crd       *k8s.CRD
 
-	queue workqueue.RateLimitingInterface
+	namespace       string
+	namespaceFilter func(namespace string) bool
+
+	defaults *v1.WebServerClusterDefaults
+	recorder record.EventRecorder
+	plan     *k8s.Plan
+
+	// informer store of WebServerClusters
+	store cache.Store
+	// keys of WebServerClusters in namespace/name format
+	queue *trackingQueue
+
+	// guards store against metrics collection, and running workers against ShutDown
+	lock       sync.Mutex
+	shutdown   bool
+	runWorkers sync.WaitGroup
 
 	logger *log.Entry
 }
 
 func NewWSController(config *WSControllerConfig) *WSController {
-	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(),
-		"ws-cluster-queue")
+	queue := newTrackingQueue(workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(),
+		"ws-cluster-queue"))
 
 	controller := &WSController{
-		kubeConfig: config.KubeConfig,
-		aeClient:   config.AEClient,
-		kubeClient: config.KubeClient,
-		crd:        config.Crd,
-		crdI:       k8s.NewCRD(config.AEClient),
-		deployI:    k8s.NewDeployment(config.KubeClient, config.Namespace),
-		svcI:       k8s.NewService(config.KubeClient, config.Namespace),
-		queue:      queue,
-		logger:     log.WithField("service", "controller"),
+		kubeConfig:      config.KubeConfig,
+		aeClient:        config.AEClient,
+		kubeClient:      config.KubeClient,
+		crd:             config.Crd,
+		namespace:       config.Namespace,
+		namespaceFilter: config.NamespaceFilter,
+		defaults:        config.Defaults,
+		recorder:        config.Recorder,
+		plan:            config.DryRunPlan,
+		crdI:            k8s.NewCRD(config.AEClient),
+		deployI:         k8s.NewDeployment(config.KubeClient),
+		svcI:            k8s.NewService(config.KubeClient),
+		queue:           queue,
+		logger:          log.WithField("service", "controller"),
+	}
+	if config.DryRunPlan != nil {
+		controller.deployI = k8s.NewDryRunDeployment(controller.deployI, config.DryRunPlan)
+		controller.svcI = k8s.NewDryRunService(controller.svcI, config.DryRunPlan)
 	}
 
 	return controller
 }
 
+// Run runs workers until stopCh is closed and the workers return. The queue makes sure
+// that a WebServerCluster is never reconciled by multiple workers at the same time.
+func (w *WSController) Run(workers int, stopCh <-chan struct{}) {
+	w.lock.Lock()
+	if w.shutdown {
+		w.lock.Unlock()
+		return
+	}
+	w.runWorkers.Add(workers)
+	w.lock.Unlock()
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer w.runWorkers.Done()
+			wait.Until(w.Worker, time.Second, stopCh)
+		}()
+	}
+}
+
+// ShutDown shuts down the queue, and waits for in-flight WebServerClusters to be reconciled
+// within gracePeriod. Queued WebServerClusters are left to the resync after restart.
+func (w *WSController) ShutDown(gracePeriod time.Duration) error {
+	w.lock.Lock()
+	w.shutdown = true
+	w.lock.Unlock()
+
+	w.queue.ShutDown()
+
+	done := make(chan struct{})
+	go func() {
+		w.runWorkers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		w.logger.Info("Successfully shut down workers")
+		return nil
+	case <-time.After(gracePeriod):
+		return fmt.Errorf("workers are not shut down within %v", gracePeriod)
+	}
+}
+
 func (w *WSController) Worker() {
 	for w.processNextWorkItem() {
 	}
 }
 
 func (w *WSController) processNextWorkItem() bool {
-	task, quit := w.queue.Get()
+	key, quit := w.queue.Get()
 	if quit {
 		return false
 	}
-	defer w.queue.Done(task)
+	defer w.queue.Done(key)
+	if w.queue.ShuttingDown() {
+		// drop the key queued before shutdown, the initial list of the next leader reconciles it again
+		w.queue.Forget(key)
+		return false
+	}
 
-	err := w.sync(task)
-	w.handleErr(err, task)
+	start := time.Now()
+	err := w.reconcile(key.(string))
+	result := w.handleErr(err, key)
+	observeReconcile(result, time.Since(start))
 
 	return true
 }
 
-func (w *WSController) handleErr(err error, task interface{}) {
+// handleErr requeues key on error, and returns the reconcile result for metrics.
+func (w *WSController) handleErr(err error, key interface{}) string {
 	if err == nil {
-		w.queue.Forget(task)
-		return
+		w.queue.Forget(key)
+		return reconcileResultSuccess
 	}
 
-	if w.queue.NumRequeues(task) < maxRetries {
-		crdTask := task.(*CRDTask)
-		crdObj := crdTask.CRDObj.(*v1.WebServerCluster)
-		w.logger.Infof("Error syncing CRD: %s %+v, %v", crdTask.CRDTaskType, *crdObj, err)
-		w.queue.AddRateLimited(task)
-		return
+	if w.queue.NumRequeues(key) < maxRetries {
+		w.logger.Infof("Error syncing WebServerCluster %v: %v", key, err)
+		w.recordEventByKey(key, apiv1.EventTypeWarning, reasonReconcileFailed, "Failed to reconcile: %v", err)
+		w.queue.AddRateLimited(key)
+		return reconcileResultRetry
 	}
 
 	utilruntime.HandleError(err)
-	w.logger.Errorf("Dropping CRD %q out of the queue: %v", task, err)
-	w.queue.Forget(task)
+	w.logger.Errorf("Dropping WebServerCluster %q out of the queue: %v", key, err)
+	w.recordEventByKey(key, apiv1.EventTypeWarning, reasonDroppedFromQueue,
+		"Dropped out of the queue after %d retries: %v", maxRetries, err)
+	w.queue.Forget(key)
+	return reconcileResultDropped
 }
 
-func (w *WSController) enqueueTask(taskType TaskType, ws *v1.WebServerCluster,
-	status *v1.WebServerClusterStatus) {
-	w.queue.Add(&CRDTask{
-		CRDTaskType:   taskType,
-		CRDObj:        ws,
-		CRDFObjStatus: status,
-	})
+// SetListers sets the listers which owned deployments and services are read from.
+func (w *WSController) SetListers(deployLister *k8s.DeploymentLister, svcLister *k8s.ServiceLister) {
+	w.deployLister = deployLister
+	w.svcLister = svcLister
 }
 
-func (w *WSController) sync(task interface{}) error {
-	crdTask := task.(*CRDTask)
-	wsCluster := crdTask.CRDObj.(*v1.WebServerCluster)
+// SetStore sets the informer store which WebServerClusters are read from.
+func (w *WSController) SetStore(store cache.Store) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.store = store
+}
 
-	var err error
-	switch crdTask.CRDTaskType {
-	case TaskTypeAdd:
-		err = w.createWebServerCluster(wsCluster)
-	case TaskTypeUpdate:
-		err = w.updateWebServerCluster(wsCluster)
-	case TaskTypeDelete:
-		err = w.deleteWebServerCluster(wsCluster)
-	case TaskTypeUpdateStatus:
-		err = w.UpdateStatus(wsCluster, crdTask.CRDFObjStatus.(*v1.WebServerClusterStatus))
+// Enqueue adds the key of WebServerCluster, or its tombstone, to the queue,
+// unless its namespace is not served.
+func (w *WSController) Enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	if !w.ServesNamespace(namespace) {
+		return
+	}
+	w.queue.Add(key)
+}
+
+// ServesNamespace returns whether WebServerClusters in namespace are reconciled.
+func (w *WSController) ServesNamespace(namespace string) bool {
+	return w.namespaceFilter == nil || w.namespaceFilter(namespace)
+}
+
+// reconcile converges the deployment, service and status of WebServerCluster
+// to its current spec, no matter which event triggers it.
+func (w *WSController) reconcile(key string) error {
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	// the namespace may be released after the key is queued
+	if !w.ServesNamespace(namespace) {
+		w.logger.Debugf("Skip WebServerCluster %s in unserved namespace", key)
+		return nil
+	}
+
+	obj, exists, err := w.store.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// deployment and service are cleaned up by finalizer before, or by
+		// garbage collector if the cluster is deleted before finalizer is added
+		w.logger.Infof("WebServerCluster %s is deleted", key)
+		return nil
 	}
 
+	ws := obj.(*v1.WebServerCluster)
+	if ws.ObjectMeta.DeletionTimestamp != nil {
+		return w.finalizeWebServerCluster(ws)
+	}
+
+	ws, err = w.initWebServerCluster(ws)
+	var deploy *extensionsv1beta1.Deployment
+	if err == nil {
+		deploy, err = w.reconcileDeployment(ws)
+	}
+	if err == nil {
+		err = w.reconcileService(ws)
+	}
+
+	statusErr := w.updateStatusByReconcile(ws, deploy, err)
+	if statusErr != nil {
+		w.logger.Warnf("Failed to update status of WebServerCluster %s: %v", key, statusErr)
+	}
+	if _, ok := err.(validationError); ok {
+		// the spec update enqueues it again
+		w.logger.Warnf("Skip invalid WebServerCluster %s: %v", key, err)
+		return statusErr
+	}
+	if err == nil {
+		err = statusErr
+	}
 	return err
 }
 
 func (w *WSController) OnAdd(obj interface{}) {
-	wsCluster := obj.(*v1.WebServerCluster)
-	w.enqueueTask(TaskTypeAdd, wsCluster, nil)
+	w.Enqueue(obj)
 }
 
 func (w *WSController) OnUpdate(oldObj, newObj interface{}) {
 	oldWSCluster := oldObj.(*v1.WebServerCluster)
 	newWSCluster := newObj.(*v1.WebServerCluster)
 
-	if !reflect.DeepEqual(oldWSCluster.Spec, newWSCluster.Spec) {
-		w.enqueueTask(TaskTypeUpdate, newWSCluster, nil)
+	// skip the updates made by status writes
+	if oldWSCluster.ResourceVersion != newWSCluster.ResourceVersion &&
+		reflect.DeepEqual(oldWSCluster.Spec, newWSCluster.Spec) &&
+		oldWSCluster.Generation == newWSCluster.Generation &&
+		reflect.DeepEqual(oldWSCluster.DeletionTimestamp, newWSCluster.DeletionTimestamp) {
+		return
 	}
+	w.Enqueue(newObj)
 }
 
 func (w *WSController) OnDelete(obj interface{}) {
-	wsCluster := obj.(*v1.WebServerCluster)
-	w.enqueueTask(TaskTypeDelete, wsCluster, nil)
+	// obj is a cache.DeletedFinalStateUnknown tombstone if the deletion is missed by watch,
+	// whose key is still namespace/name
+	w.Enqueue(obj)
 }
 
-func (w *WSController) UpdateStatusForObj(obj interface{}, status interface{}) {
-	wsCluster := obj.(*v1.WebServerCluster)
-	wsClusterStatus := obj.(*v1.WebServerClusterStatus)
-	if !reflect.DeepEqual(wsCluster.Status, *wsClusterStatus) {
-		w.enqueueTask(TaskTypeUpdateStatus, wsCluster, wsClusterStatus)
-	}
+// UpdateStatus writes status of ws, and retries with the latest WebServerCluster on conflict.
+func (w *WSController) UpdateStatus(ws *v1.WebServerCluster, status *v1.WebServerClusterStatus) error {
+	current := ws
+	return k8s.RetryOnConflict(k8s.DefaultRetry, func() error {
+		err := w.putStatus(current, status)
+		if apierrors.IsConflict(err) {
+			if latest, getErr := w.getWebServerCluster(ws.ObjectMeta.Namespace, ws.ObjectMeta.Name); getErr == nil {
+				current = latest
+			}
+		}
+		return err
+	})
 }
 
-func (w *WSController) UpdateStatus(ws *v1.WebServerCluster, status *v1.WebServerClusterStatus) error {
-	crdClient, crdScheme, err := w.getCRDClientScheme()
+func (w *WSController) putStatus(ws *v1.WebServerCluster, status *v1.WebServerClusterStatus) error {
+	crdClient, _, err := w.getCRDClientScheme()
 	if err != nil {
 		return err
 	}
 
-	copyObj, err := crdScheme.DeepCopy(ws)
+	newStatus := mergeStatus(&ws.Status, status)
+	if reflect.DeepEqual(ws.Status, newStatus) {
+		return nil
+	}
+
+	wsTask, err := w.copyWebServerCluster(ws)
 	if err != nil {
 		return err
 	}
-	wsTask, ok := copyObj.(*v1.WebServerCluster)
-	if !ok {
-		return errors.New("Failed to convert object")
-	}
-
-	if reflect.DeepEqual(ws.Status, *status) {
+	wsTask.Status = newStatus
+	if w.plan != nil {
+		w.plan.Record(&k8s.PlannedChange{Action: k8s.PlanUpdate, Kind: w.crd.Kind,
+			Namespace: ws.ObjectMeta.Namespace, Name: ws.ObjectMeta.Name, Subresource: "status", Object: wsTask})
 		return nil
 	}
-
-	wsTask.Status = *status
 	err = crdClient.Put().
 		Namespace(ws.ObjectMeta.Namespace).
 		Name(ws.ObjectMeta.Name).
 		Resource(w.crd.Plural).
+		SubResource("status").
 		Body(wsTask).
 		Do().
 		Error()
 	if err == nil {
 		w.logger.Infof("Successfully change WebServerCluster %s status from %v to %v", ws.ObjectMeta.Name,
-			ws.Status, *status)
+			ws.Status, newStatus)
 	}
 	return err
 }
 
-func (w *WSController) deleteWebServerCluster(ws *v1.WebServerCluster) error {
-	deletePolicy := metav1.DeletePropagationBackground
-	deleteOptions := &metav1.DeleteOptions{
-		PropagationPolicy: &deletePolicy,
-	}
-	if err := w.deployI.Delete(ws.ObjectMeta.Name, deleteOptions); err != nil {
-		return err
+// initWebServerCluster applies defaults on ws spec and adds the cleanup finalizer,
+// and writes them back to WebServerCluster.
+func (w *WSController) initWebServerCluster(ws *v1.WebServerCluster) (*v1.WebServerCluster, error) {
+	wsCopy, err := w.updateWebServerCluster(ws, func(wsCopy *v1.WebServerCluster) bool {
+		changed := v1.SetDefaults(&wsCopy.Spec, w.defaults)
+		if !wsCopy.HasFinalizer(v1.WebServerClusterFinalizer) {
+			wsCopy.ObjectMeta.Finalizers = append(wsCopy.ObjectMeta.Finalizers, v1.WebServerClusterFinalizer)
+			changed = true
+		}
+		return changed
+	})
+	if err != nil {
+		return ws, err
 	}
-	if err := w.svcI.Delete(ws.ObjectMeta.Name, nil); err != nil {
-		return err
+	if wsCopy != ws {
+		w.logger.Infof("Successfully initialize WebServerCluster %s: %+v", ws.ObjectMeta.Name, wsCopy.Spec)
 	}
-	w.logger.Infof("Successfully delete web server cluster %s", ws.ObjectMeta.Name)
-	return nil
-}
 
-func (w *WSController) updateWebServerCluster(ws *v1.WebServerCluster) error {
-	owners := []metav1.OwnerReference{w.newOwnerRefOfWebServerCluster(ws)}
-	wsDeployData := w.newWebServerClusterDeploymentData(ws)
-	wsDeploy := w.deployI.MakeConfig(wsDeployData)
-	wsDeploy.OwnerReferences = owners
-	if _, err := w.deployI.Update(wsDeploy); err != nil {
-		return err
+	if wsCopy.Spec.Image == "" {
+		w.recordEvent(wsCopy, apiv1.EventTypeWarning, reasonValidationFailed,
+			"spec.image is required, and no default image is configured")
+		return wsCopy, validationError{errors.New("spec.image is required")}
 	}
-	w.logger.Infof("Successfully update web server cluster %s", ws.ObjectMeta.Name)
-	return nil
+	return wsCopy, nil
 }
 
-func (w *WSController) createWebServerCluster(ws *v1.WebServerCluster) error {
-	owners := []metav1.OwnerReference{w.newOwnerRefOfWebServerCluster(ws)}
+// validationError is a permanent failure of an invalid spec, which is not retried until
+// the WebServerCluster is updated.
+type validationError struct {
+	error
+}
 
-	wsDeployData := w.newWebServerClusterDeploymentData(ws)
-	wsDeploy := w.deployI.MakeConfig(wsDeployData)
-	wsDeploy.OwnerReferences = owners
-	_, err := w.deployI.Create(wsDeploy)
-	if err != nil && !apierrors.IsAlreadyExists(err) {
-		return err
+// updateStatusByReconcile updates status from the owned deployment and the reconcile result.
+func (w *WSController) updateStatusByReconcile(ws *v1.WebServerCluster, deploy *extensionsv1beta1.Deployment,
+	syncErr error) error {
+	status := ws.Status
+	// don't modify the conditions of cached object
+	status.Conditions = append([]v1.WebServerClusterCondition{}, ws.Status.Conditions...)
+	if deploy != nil {
+		status = *NewWebServerClusterStatus(ws, deploy)
+	}
+	if syncErr != nil {
+		status.ObservedGeneration = ws.Status.ObservedGeneration
 	}
+	v1.SetCondition(&status, newReconcileCondition(syncErr))
+	return w.UpdateStatus(ws, &status)
+}
 
-	wsServiceData := w.newWebServerClusterServiceData(ws)
-	_, err = w.svcI.Get(ws.ObjectMeta.Name)
-	if err != nil && !apierrors.IsNotFound(err) {
-		return err
+func (w *WSController) copyWebServerCluster(ws *v1.WebServerCluster) (*v1.WebServerCluster, error) {
+	_, crdScheme, err := w.getCRDClientScheme()
+	if err != nil {
+		return nil, err
+	}
+	copyObj, err := crdScheme.DeepCopy(ws)
+	if err != nil {
+		return nil, err
 	}
+	wsCopy, ok := copyObj.(*v1.WebServerCluster)
+	if !ok {
+		return nil, errors.New("Failed to convert object")
+	}
+	return wsCopy, nil
+}
 
-	if apierrors.IsNotFound(err) {
-		wsSvc := w.svcI.MakeConfig(wsServiceData)
-		wsSvc.OwnerReferences = owners
-		_, err = w.svcI.Create(wsSvc)
+// updateWebServerCluster applies mutate on a copy of ws and writes it back if mutate returns true,
+// and retries with the latest WebServerCluster on conflict. It returns ws itself if nothing changes.
+func (w *WSController) updateWebServerCluster(ws *v1.WebServerCluster,
+	mutate func(*v1.WebServerCluster) bool) (*v1.WebServerCluster, error) {
+	current := ws
+	result := ws
+	err := k8s.RetryOnConflict(k8s.DefaultRetry, func() error {
+		wsCopy, err := w.copyWebServerCluster(current)
 		if err != nil {
-			if apierrors.IsAlreadyExists(err) {
-				return nil
-			}
 			return err
 		}
+		if !mutate(wsCopy) {
+			result = current
+			return nil
+		}
+		result, err = w.putWebServerCluster(wsCopy)
+		if apierrors.IsConflict(err) {
+			if latest, getErr := w.getWebServerCluster(ws.ObjectMeta.Namespace, ws.ObjectMeta.Name); getErr == nil {
+				current = latest
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return ws, err
 	}
+	return result, nil
+}
 
-	w.logger.Infof("Successfully create web server cluster %s", ws.ObjectMeta.Name)
-	return nil
+// getWebServerCluster reads the latest WebServerCluster from api server rather than the store.
+func (w *WSController) getWebServerCluster(namespace, name string) (*v1.WebServerCluster, error) {
+	crdClient, _, err := w.getCRDClientScheme()
+	if err != nil {
+		return nil, err
+	}
+	result := &v1.WebServerCluster{}
+	err = crdClient.Get().
+		Namespace(namespace).
+		Name(name).
+		Resource(w.crd.Plural).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// putWebServerCluster writes the metadata and spec of ws, status is ignored by the status subresource.
+// It returns ws as if it were written in dry-run mode.
+func (w *WSController) putWebServerCluster(ws *v1.WebServerCluster) (*v1.WebServerCluster, error) {
+	crdClient, _, err := w.getCRDClientScheme()
+	if err != nil {
+		return nil, err
+	}
+	if w.plan != nil {
+		w.plan.Record(&k8s.PlannedChange{Action: k8s.PlanUpdate, Kind: w.crd.Kind,
+			Namespace: ws.ObjectMeta.Namespace, Name: ws.ObjectMeta.Name, Object: ws})
+		return ws, nil
+	}
+	result := &v1.WebServerCluster{}
+	err = crdClient.Put().
+		Namespace(ws.ObjectMeta.Namespace).
+		Name(ws.ObjectMeta.Name).
+		Resource(w.crd.Plural).
+		Body(ws).
+		Do().
+		Into(result)
+	return result, err
 }
 
 func (w *WSController) newWebServerClusterDeploymentData(ws *v1.WebServerCluster) *k8s.DeploymentData {
 	return &k8s.DeploymentData{
-		Name: ws.ObjectMeta.Name,
+		Name:      ws.ObjectMeta.Name,
+		Namespace: ws.ObjectMeta.Namespace,
+		Labels:    newOwnershipLabels(ws),
 		Spec: extensionsv1beta1.DeploymentSpec{
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
@@ -279,11 +533,7 @@ func (w *WSController) newWebServerClusterDeploymentData(ws *v1.WebServerCluster
 						{
 							Name:  "ws-" + ws.ObjectMeta.Name,
 							Image: ws.Spec.Image,
-							Ports: []apiv1.ContainerPort{
-								{
-									ContainerPort: 80,
-								},
-							},
+							Ports: newContainerPorts(ws),
 						},
 					},
 				},
@@ -294,25 +544,103 @@ func (w *WSController) newWebServerClusterDeploymentData(ws *v1.WebServerCluster
 }
 
 func (w *WSController) newWebServerClusterServiceData(ws *v1.WebServerCluster) *k8s.ServiceData {
-	return &k8s.ServiceData{
-		Name: ws.ObjectMeta.Name,
+	data := &k8s.ServiceData{
+		Name:      ws.ObjectMeta.Name,
+		Namespace: ws.ObjectMeta.Namespace,
+		Labels:    newOwnershipLabels(ws),
 		Spec: apiv1.ServiceSpec{
 			Selector: map[string]string{
 				"app": "ws-cluster-" + ws.ObjectMeta.Name,
 			},
-			Ports: []apiv1.ServicePort{
-				{
-					TargetPort: intstr.FromInt(80),
-					NodePort:   ws.Spec.ServicePort,
-					Port:       80,
-				},
-			},
-			Type: "LoadBalancer",
+			Ports:           newServicePorts(ws),
+			Type:            apiv1.ServiceTypeLoadBalancer,
+			SessionAffinity: apiv1.ServiceAffinityNone,
 		},
 	}
+
+	switch ws.Spec.ServiceType() {
+	case v1.ServiceTypeClusterIP:
+		data.Spec.Type = apiv1.ServiceTypeClusterIP
+	case v1.ServiceTypeHeadless:
+		data.Spec.Type = apiv1.ServiceTypeClusterIP
+		data.Spec.ClusterIP = apiv1.ClusterIPNone
+	case v1.ServiceTypeNodePort:
+		data.Spec.Type = apiv1.ServiceTypeNodePort
+	}
+
+	appProtocols := newAppProtocolsAnnotation(ws)
+	if appProtocols != "" {
+		data.Annotations = map[string]string{appProtocolsKey: appProtocols}
+	}
+
+	svcSpec := ws.Spec.Service
+	if svcSpec == nil {
+		return data
+	}
+	for k, v := range svcSpec.Annotations {
+		if data.Annotations == nil {
+			data.Annotations = map[string]string{}
+		}
+		data.Annotations[k] = v
+	}
+	if svcSpec.SessionAffinity != "" {
+		data.Spec.SessionAffinity = apiv1.ServiceAffinity(svcSpec.SessionAffinity)
+	}
+	if data.Spec.Type == apiv1.ServiceTypeLoadBalancer {
+		data.Spec.LoadBalancerSourceRanges = svcSpec.LoadBalancerSourceRanges
+	}
+	if data.Spec.Type != apiv1.ServiceTypeClusterIP {
+		data.Spec.ExternalTrafficPolicy = apiv1.ServiceExternalTrafficPolicyType(svcSpec.ExternalTrafficPolicy)
+	}
+	return data
+}
+
+func newContainerPorts(ws *v1.WebServerCluster) []apiv1.ContainerPort {
+	ports := []apiv1.ContainerPort{}
+	for _, port := range ws.Spec.ClusterPorts() {
+		ports = append(ports, apiv1.ContainerPort{
+			Name:          port.Name,
+			ContainerPort: port.ContainerPort,
+			Protocol:      apiv1.Protocol(port.Protocol),
+		})
+	}
+	return ports
+}
+
+// newServicePorts returns the service ports, node port of cluster is set on the first one.
+func newServicePorts(ws *v1.WebServerCluster) []apiv1.ServicePort {
+	ports := []apiv1.ServicePort{}
+	for i, port := range ws.Spec.ClusterPorts() {
+		svcPort := apiv1.ServicePort{
+			Name:       port.Name,
+			Protocol:   apiv1.Protocol(port.Protocol),
+			Port:       port.ServicePort,
+			TargetPort: intstr.FromInt(int(port.ContainerPort)),
+		}
+		if i == 0 {
+			svcPort.NodePort = ws.Spec.NodePort()
+		}
+		ports = append(ports, svcPort)
+	}
+	return ports
+}
+
+// newAppProtocolsAnnotation records the application protocols of ports,
+// as the vendored ServicePort has no appProtocol field.
+func newAppProtocolsAnnotation(ws *v1.WebServerCluster) string {
+	protocols := []string{}
+	for _, port := range ws.Spec.ClusterPorts() {
+		if port.AppProtocol != "" {
+			protocols = append(protocols, port.Name+"="+port.AppProtocol)
+		}
+	}
+	return strings.Join(protocols, ",")
 }
 
 func (w *WSController) getCRDClientScheme() (*rest.RESTClient, *runtime.Scheme, error) {
+	w.crdLock.Lock()
+	defer w.crdLock.Unlock()
+
 	var err error
 	if w.crdClient == nil || w.crdScheme == nil {
 		crdRestClientConfig := &k8s.CRDRestClientConfig{
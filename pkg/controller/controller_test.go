@@ -0,0 +1,474 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+	"github.com/mathspanda/ws-operator-demo/pkg/k8s"
+	"github.com/mathspanda/ws-operator-demo/pkg/record"
+)
+
+// fakeDeployments writes deployments to the informer indexer, as if they were seen by the informer.
+// Each call takes latency, as a round trip to api server.
+type fakeDeployments struct {
+	k8s.DeploymentInterface
+	indexer cache.Indexer
+	latency time.Duration
+
+	lock    sync.Mutex
+	patches [][]byte
+}
+
+func (f *fakeDeployments) Create(deploy *extensionsv1beta1.Deployment) (*extensionsv1beta1.Deployment, error) {
+	time.Sleep(f.latency)
+	if _, exists, _ := f.indexer.Get(deploy); exists {
+		return nil, apierrors.NewAlreadyExists(schema.GroupResource{Resource: "deployments"}, deploy.Name)
+	}
+	return deploy, f.indexer.Add(deploy)
+}
+
+func (f *fakeDeployments) Delete(namespace, name string, options *metav1.DeleteOptions) error {
+	time.Sleep(f.latency)
+	deploy, err := k8s.NewDeploymentLister(f.indexer).Get(namespace, name)
+	if err != nil {
+		return err
+	}
+	return f.indexer.Delete(deploy)
+}
+
+func (f *fakeDeployments) Update(deploy *extensionsv1beta1.Deployment) (*extensionsv1beta1.Deployment, error) {
+	time.Sleep(f.latency)
+	return deploy, f.indexer.Update(deploy)
+}
+
+func (f *fakeDeployments) Get(namespace, name string) (*extensionsv1beta1.Deployment, error) {
+	time.Sleep(f.latency)
+	return k8s.NewDeploymentLister(f.indexer).Get(namespace, name)
+}
+
+func (f *fakeDeployments) List(namespace string, options metav1.ListOptions) (*extensionsv1beta1.DeploymentList, error) {
+	time.Sleep(f.latency)
+	list := &extensionsv1beta1.DeploymentList{}
+	for _, obj := range f.indexer.List() {
+		if deploy := obj.(*extensionsv1beta1.Deployment); deploy.Namespace == namespace {
+			list.Items = append(list.Items, *deploy)
+		}
+	}
+	return list, nil
+}
+
+// Patch records the patch, and applies its replicas and container images on the live deployment.
+func (f *fakeDeployments) Patch(namespace, name string, pt types.PatchType,
+	data []byte) (*extensionsv1beta1.Deployment, error) {
+	time.Sleep(f.latency)
+	f.lock.Lock()
+	f.patches = append(f.patches, data)
+	f.lock.Unlock()
+
+	var patch struct {
+		Spec struct {
+			Replicas *int32 `json:"replicas"`
+			Template struct {
+				Spec struct {
+					Containers []apiv1.Container `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	deploy, err := k8s.NewDeploymentLister(f.indexer).Get(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if patch.Spec.Replicas != nil {
+		deploy.Spec.Replicas = patch.Spec.Replicas
+	}
+	for _, c := range patch.Spec.Template.Spec.Containers {
+		if live := findContainer(deploy.Spec.Template.Spec.Containers, c.Name); live != nil {
+			live.Image = c.Image
+		}
+	}
+	return deploy, f.indexer.Update(deploy)
+}
+
+// fakeServices writes services to the informer indexer, as if they were seen by the informer.
+// Each call takes latency, as a round trip to api server.
+type fakeServices struct {
+	k8s.ServiceInterface
+	indexer cache.Indexer
+	latency time.Duration
+}
+
+func (f *fakeServices) Create(svc *apiv1.Service) (*apiv1.Service, error) {
+	time.Sleep(f.latency)
+	if _, exists, _ := f.indexer.Get(svc); exists {
+		return nil, apierrors.NewAlreadyExists(schema.GroupResource{Resource: "services"}, svc.Name)
+	}
+	return svc, f.indexer.Add(svc)
+}
+
+func (f *fakeServices) Delete(namespace, name string, options *metav1.DeleteOptions) error {
+	time.Sleep(f.latency)
+	svc, err := k8s.NewServiceLister(f.indexer).Get(namespace, name)
+	if err != nil {
+		return err
+	}
+	return f.indexer.Delete(svc)
+}
+
+func (f *fakeServices) Update(svc *apiv1.Service) (*apiv1.Service, error) {
+	time.Sleep(f.latency)
+	return svc, f.indexer.Update(svc)
+}
+
+func (f *fakeServices) Get(namespace, name string) (*apiv1.Service, error) {
+	time.Sleep(f.latency)
+	return k8s.NewServiceLister(f.indexer).Get(namespace, name)
+}
+
+func (f *fakeServices) List(namespace string, options metav1.ListOptions) (*apiv1.ServiceList, error) {
+	time.Sleep(f.latency)
+	list := &apiv1.ServiceList{}
+	for _, obj := range f.indexer.List() {
+		if svc := obj.(*apiv1.Service); svc.Namespace == namespace {
+			list.Items = append(list.Items, *svc)
+		}
+	}
+	return list, nil
+}
+
+// Patch returns the live service, as patches of reconciled services are not expected.
+func (f *fakeServices) Patch(namespace, name string, pt types.PatchType, data []byte) (*apiv1.Service, error) {
+	time.Sleep(f.latency)
+	return k8s.NewServiceLister(f.indexer).Get(namespace, name)
+}
+
+// newFakeWebServerClusterServer accepts writes of WebServerClusters and their status, and
+// writes them to store, as if they were seen by the informer. Each request takes latency.
+func newFakeWebServerClusterServer(store cache.Store, latency time.Duration) *httptest.Server {
+	var lock sync.Mutex
+	resourceVersion := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latency)
+		if r.Method != http.MethodPut {
+			http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+			return
+		}
+		ws := &v1.WebServerCluster{}
+		if err := json.NewDecoder(r.Body).Decode(ws); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		resourceVersion++
+		ws.ResourceVersion = strconv.Itoa(resourceVersion)
+		lock.Unlock()
+		if err := store.Update(ws); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ws)
+	}))
+}
+
+func newTestCRD() *k8s.CRD {
+	return &k8s.CRD{
+		Name:          v1.CRDName,
+		Kind:          v1.CRDKind,
+		Plural:        v1.CRDPlural,
+		Group:         v1.CRDGroup,
+		Version:       v1.CRDVersion,
+		Obj:           &v1.WebServerCluster{},
+		ObjList:       &v1.WebServerClusterList{},
+		SchemeBuilder: v1.AddKnownTypes,
+	}
+}
+
+// fakeRecorder keeps the reasons of recorded events.
+type fakeRecorder struct {
+	lock    sync.Mutex
+	reasons []string
+}
+
+func (f *fakeRecorder) Event(ref *apiv1.ObjectReference, eventType, reason, message string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.reasons = append(f.reasons, reason)
+}
+
+func (f *fakeRecorder) Eventf(ref *apiv1.ObjectReference, eventType, reason, messageFmt string,
+	args ...interface{}) {
+	f.Event(ref, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// newTestController returns a controller serving WebServerClusters of store with fake clients,
+// whose calls take latency.
+func newTestController(t testing.TB, host string, store cache.Store, latency time.Duration,
+	defaults *v1.WebServerClusterDefaults, recorder record.EventRecorder) *WSController {
+	deployIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{k8s.OwnerUIDIndex: k8s.OwnerUIDIndexFunc})
+	svcIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{k8s.OwnerUIDIndex: k8s.OwnerUIDIndexFunc})
+
+	// status writes are not throttled
+	kubeConfig := &rest.Config{Host: host, QPS: 1e6, Burst: 1e6}
+	aeClient, err := apiextensionsclient.NewForConfig(kubeConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWSController(&WSControllerConfig{
+		KubeConfig: kubeConfig,
+		AEClient:   aeClient,
+		Crd:        newTestCRD(),
+		Defaults:   defaults,
+		Recorder:   recorder,
+	})
+	w.deployI = &fakeDeployments{DeploymentInterface: w.deployI, indexer: deployIndexer, latency: latency}
+	w.svcI = &fakeServices{ServiceInterface: w.svcI, indexer: svcIndexer, latency: latency}
+	w.SetListers(k8s.NewDeploymentLister(deployIndexer), k8s.NewServiceLister(svcIndexer))
+	w.SetStore(store)
+	return w
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	server := newFakeWebServerClusterServer(store, 0)
+	defer server.Close()
+	recorder := &fakeRecorder{}
+	w := newTestController(t, server.URL, store, 0, &v1.WebServerClusterDefaults{Replicas: 1}, recorder)
+
+	ws := &v1.WebServerCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "ns",
+			Name:       "ws",
+			Finalizers: []string{v1.WebServerClusterFinalizer},
+		},
+	}
+	if err := store.Add(ws); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.reconcile("ns/ws"); err != nil {
+		t.Fatalf("expect invalid spec not to be retried, got %v", err)
+	}
+	if len(recorder.reasons) != 1 || recorder.reasons[0] != reasonValidationFailed {
+		t.Fatalf("expect %s event, got %v", reasonValidationFailed, recorder.reasons)
+	}
+	obj, _, err := store.GetByKey("ns/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition := v1.GetCondition(&obj.(*v1.WebServerCluster).Status, v1.WebServerClusterReconcileError)
+	if condition == nil || condition.Status != v1.ConditionTrue || condition.Message != "spec.image is required" {
+		t.Fatalf("expect ReconcileError condition of missing image, got %+v", condition)
+	}
+	if _, err := w.deployLister.Get("ns", "ws"); !apierrors.IsNotFound(err) {
+		t.Fatalf("expect no deployment of invalid spec, got %v", err)
+	}
+}
+
+func TestReconcileUnspecifiedReplicas(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	server := newFakeWebServerClusterServer(store, 0)
+	defer server.Close()
+	w := newTestController(t, server.URL, store, 0, &v1.WebServerClusterDefaults{Replicas: 2}, nil)
+	deployI := w.deployI.(*fakeDeployments)
+
+	ws := &v1.WebServerCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "ns",
+			Name:       "ws",
+			Finalizers: []string{v1.WebServerClusterFinalizer},
+		},
+		Spec: v1.WebServerClusterSpec{Image: "nginx"},
+	}
+	if err := store.Add(ws); err != nil {
+		t.Fatal(err)
+	}
+	reconcile := func(update func(ws *v1.WebServerCluster)) map[string]interface{} {
+		obj, _, _ := store.GetByKey("ns/ws")
+		wsCopy := *obj.(*v1.WebServerCluster)
+		update(&wsCopy)
+		if err := store.Update(&wsCopy); err != nil {
+			t.Fatal(err)
+		}
+		deployI.patches = nil
+		if err := w.reconcile("ns/ws"); err != nil {
+			t.Fatal(err)
+		}
+		if len(deployI.patches) != 1 {
+			t.Fatalf("expect deployment patched once, got %d patches", len(deployI.patches))
+		}
+		patch := map[string]map[string]interface{}{}
+		if err := json.Unmarshal(deployI.patches[0], &patch); err != nil {
+			t.Fatal(err)
+		}
+		return patch["spec"]
+	}
+
+	// created with default replicas, which are not written to the cluster
+	if err := w.reconcile("ns/ws"); err != nil {
+		t.Fatal(err)
+	}
+	deploy, err := w.deployLister.Get("ns", "ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deploy.Spec.Replicas == nil || *deploy.Spec.Replicas != 2 {
+		t.Fatalf("expect deployment created with default replicas 2, got %v", deploy.Spec.Replicas)
+	}
+	if obj, _, _ := store.GetByKey("ns/ws"); obj.(*v1.WebServerCluster).Spec.Replicas != nil {
+		t.Fatal("expect default replicas not written to WebServerCluster")
+	}
+
+	// scaled by HPA
+	replicas := int32(5)
+	deploy.Spec.Replicas = &replicas
+	if err := deployI.indexer.Update(deploy); err != nil {
+		t.Fatal(err)
+	}
+	if spec := reconcile(func(ws *v1.WebServerCluster) { ws.Spec.Image = "nginx:1.15" }); spec["replicas"] != nil {
+		t.Fatalf("expect unspecified replicas not patched, got %v", spec["replicas"])
+	}
+
+	specified := int32(3)
+	if spec := reconcile(func(ws *v1.WebServerCluster) { ws.Spec.Replicas = &specified }); spec["replicas"] != 3.0 {
+		t.Fatalf("expect specified replicas 3 patched, got %v", spec["replicas"])
+	}
+}
+
+// benchmarkLatency is the latency of api server calls in benchmarks.
+const benchmarkLatency = time.Millisecond
+
+// newBenchmarkController returns a controller serving clusters WebServerClusters with fake
+// clients, and their keys.
+func newBenchmarkController(b *testing.B, host string, store cache.Store, clusters int) (*WSController, []string) {
+	w := newTestController(b, host, store, benchmarkLatency, &v1.WebServerClusterDefaults{Replicas: 1}, nil)
+
+	keys := make([]string, 0, clusters)
+	for i := 0; i < clusters; i++ {
+		replicas := int32(2)
+		ws := &v1.WebServerCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:  fmt.Sprintf("ns-%d", i%10),
+				Name:       fmt.Sprintf("ws-%d", i),
+				UID:        types.UID(fmt.Sprintf("uid-%d", i)),
+				Finalizers: []string{v1.WebServerClusterFinalizer},
+			},
+			Spec: v1.WebServerClusterSpec{Replicas: &replicas, Image: "nginx"},
+		}
+		if err := store.Add(ws); err != nil {
+			b.Fatal(err)
+		}
+		keys = append(keys, ws.Namespace+"/"+ws.Name)
+	}
+	return w, keys
+}
+
+// updateImages sets image on the WebServerClusters of keys, so that their deployments are patched
+// on the next reconcile.
+func updateImages(b *testing.B, store cache.Store, keys []string, image string) {
+	for _, key := range keys {
+		obj, _, err := store.GetByKey(key)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ws := *obj.(*v1.WebServerCluster)
+		ws.Spec.Image = image
+		if err := store.Update(&ws); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// processKeys adds keys to the queue, and runs workers until they are processed.
+func processKeys(w *WSController, workers int, keys []string) {
+	for _, key := range keys {
+		w.queue.Add(key)
+	}
+	remaining := int64(len(keys))
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for atomic.AddInt64(&remaining, -1) >= 0 {
+				w.processNextWorkItem()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkReconcile measures the throughput of workers reconciling WebServerClusters whose image
+// is updated, each of which patches its deployment through an api server of benchmarkLatency.
+// ns/op is the time per WebServerCluster, and the throughput is logged in keys/s.
+func BenchmarkReconcile(b *testing.B) {
+	level := log.GetLevel()
+	log.SetLevel(log.WarnLevel)
+	defer log.SetLevel(level)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+			server := newFakeWebServerClusterServer(store, benchmarkLatency)
+			defer server.Close()
+			w, keys := newBenchmarkController(b, server.URL, store, 100)
+			deployI := w.deployI.(*fakeDeployments)
+
+			// create deployments and services, and write status
+			processKeys(w, workers, keys)
+			if len(deployI.indexer.List()) != len(keys) {
+				b.Fatalf("expect %d deployments created, got %d", len(keys), len(deployI.indexer.List()))
+			}
+			deployI.patches = nil
+
+			b.ResetTimer()
+			var elapsed time.Duration
+			for done, round := 0, 0; done < b.N; done, round = done+len(keys), round+1 {
+				n := len(keys)
+				if b.N-done < n {
+					n = b.N - done
+				}
+				b.StopTimer()
+				updateImages(b, store, keys[:n], fmt.Sprintf("nginx:%d", round))
+				b.StartTimer()
+
+				start := time.Now()
+				processKeys(w, workers, keys[:n])
+				elapsed += time.Since(start)
+			}
+			b.StopTimer()
+
+			b.Logf("%d keys in %v, %.0f keys/s", b.N, elapsed, float64(b.N)/elapsed.Seconds())
+			if w.queue.Len() != 0 {
+				b.Fatalf("expect all keys reconciled, %d keys left", w.queue.Len())
+			}
+			if len(deployI.patches) != b.N {
+				b.Fatalf("expect %d deployments patched, got %d", b.N, len(deployI.patches))
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+// reconcileDeployment creates the deployment of ws, or updates the live one
+// if it differs from the desired one, and returns the live deployment.
+func (w *WSController) reconcileDeployment(ws *v1.WebServerCluster) (*extensionsv1beta1.Deployment, error) {
+	desired := w.newDesiredDeployment(ws)
+
+	live, err := w.deployLister.Get(ws.ObjectMeta.Namespace, ws.ObjectMeta.Name)
+	if apierrors.IsNotFound(err) {
+		live, err = w.deployI.Create(w.withDefaultReplicas(desired))
+		if err == nil {
+			if isReconciled(ws) {
+				w.logger.Warnf("Restore deleted deployment %s of WebServerCluster %s", live.Name, ws.ObjectMeta.Name)
+				w.recordEvent(ws, apiv1.EventTypeNormal, reasonDriftCorrected, "Restored deleted deployment %s",
+					live.Name)
+			} else {
+				w.logger.Infof("Successfully create deployment %s", live.Name)
+				w.recordEvent(ws, apiv1.EventTypeNormal, reasonCreated, "Created deployment %s", live.Name)
+			}
+			return live, nil
+		}
+		// the informer has not seen it yet, or it is not labeled by operator, read it from api server
+		if apierrors.IsAlreadyExists(err) {
+			live, err = w.deployI.Get(ws.ObjectMeta.Namespace, ws.ObjectMeta.Name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	original := snapshotMeta(&live.ObjectMeta)
+	changed := updateDeployment(live, desired)
+	if len(changed) == 0 {
+		return live, nil
+	}
+	patch, err := newDeploymentPatch(original, live, desired.Spec.Replicas != nil)
+	if err != nil {
+		return nil, err
+	}
+	live, err = w.deployI.Patch(live.Namespace, live.Name, types.StrategicMergePatchType, patch)
+	if err != nil {
+		return nil, err
+	}
+	w.logger.Infof("Successfully update deployment %s, changed fields: %v", live.Name, changed)
+	if isDrift(ws) {
+		w.recordEvent(ws, apiv1.EventTypeNormal, reasonDriftCorrected, "Reverted drifted fields %v of deployment %s",
+			changed, live.Name)
+	} else {
+		w.recordEvent(ws, apiv1.EventTypeNormal, reasonUpdated, "Updated fields %v of deployment %s",
+			changed, live.Name)
+	}
+	return live, nil
+}
+
+// newDesiredDeployment returns the deployment which operator keeps for ws. Its replicas are nil
+// if ws replicas are unspecified, which are then left to others, e.g. HPA.
+func (w *WSController) newDesiredDeployment(ws *v1.WebServerCluster) *extensionsv1beta1.Deployment {
+	desired := w.deployI.MakeConfig(w.newWebServerClusterDeploymentData(ws))
+	desired.OwnerReferences = []metav1.OwnerReference{w.newOwnerRefOfWebServerCluster(ws)}
+	return desired
+}
+
+// withDefaultReplicas sets the default replicas on desired deployment to be created, if its
+// replicas are unspecified.
+func (w *WSController) withDefaultReplicas(desired *extensionsv1beta1.Deployment) *extensionsv1beta1.Deployment {
+	if desired.Spec.Replicas == nil && w.defaults != nil && w.defaults.Replicas > 0 {
+		replicas := w.defaults.Replicas
+		desired.Spec.Replicas = &replicas
+	}
+	return desired
+}
+
+// updateDeployment sets the fields owned by operator from desired deployment on live one,
+// keeps the fields defaulted by kubernetes, and returns the changed fields of live deployment.
+// The owned fields of updated live deployment are then sent as a patch.
+func updateDeployment(live, desired *extensionsv1beta1.Deployment) []string {
+	changed := []string{}
+
+	if mergeLabels(&live.ObjectMeta, desired.Labels) {
+		changed = append(changed, "metadata.labels")
+	}
+	if adoptObjectMeta(&live.ObjectMeta) {
+		changed = append(changed, "metadata.annotations")
+	}
+	if mergeOwnerReferences(&live.ObjectMeta, desired.OwnerReferences) {
+		changed = append(changed, "metadata.ownerReferences")
+	}
+	if desired.Spec.Replicas != nil &&
+		(live.Spec.Replicas == nil || *live.Spec.Replicas != *desired.Spec.Replicas) {
+		live.Spec.Replicas = desired.Spec.Replicas
+		changed = append(changed, "spec.replicas")
+	}
+	if !reflect.DeepEqual(live.Spec.Selector, desired.Spec.Selector) {
+		live.Spec.Selector = desired.Spec.Selector
+		changed = append(changed, "spec.selector")
+	}
+	if mergeLabels(&live.Spec.Template.ObjectMeta, desired.Spec.Template.Labels) {
+		changed = append(changed, "spec.template.metadata.labels")
+	}
+
+	// containers added by others, e.g. sidecars, are kept
+	for i := range desired.Spec.Template.Spec.Containers {
+		desiredContainer := &desired.Spec.Template.Spec.Containers[i]
+		liveContainer := findContainer(live.Spec.Template.Spec.Containers, desiredContainer.Name)
+		if liveContainer == nil {
+			live.Spec.Template.Spec.Containers = append(live.Spec.Template.Spec.Containers, *desiredContainer)
+			changed = append(changed, fmt.Sprintf("spec.template.spec.containers[%s]", desiredContainer.Name))
+			continue
+		}
+		fldPath := fmt.Sprintf("spec.template.spec.containers[%s]", desiredContainer.Name)
+		for _, fld := range updateContainer(liveContainer, desiredContainer) {
+			changed = append(changed, fldPath+fld)
+		}
+	}
+	return changed
+}
+
+func findContainer(containers []apiv1.Container, name string) *apiv1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func updateContainer(live, desired *apiv1.Container) []string {
+	changed := []string{}
+	if live.Image != desired.Image {
+		live.Image = desired.Image
+		changed = append(changed, ".image")
+	}
+	if !(len(live.Ports) == 0 && len(desired.Ports) == 0) && !reflect.DeepEqual(live.Ports, desired.Ports) {
+		live.Ports = desired.Ports
+		changed = append(changed, ".ports")
+	}
+	return changed
+}
+
+// isReconciled returns whether ws has been reconciled before,
+// which means its missing children are deleted by others.
+func isReconciled(ws *v1.WebServerCluster) bool {
+	return v1.GetCondition(&ws.Status, v1.WebServerClusterReconcileError) != nil
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+// reasons of events recorded on WebServerCluster
+const (
+	reasonCreated          = "Created"
+	reasonUpdated          = "Updated"
+	reasonDeleted          = "Deleted"
+	reasonDriftCorrected   = "DriftCorrected"
+	reasonValidationFailed = "ValidationFailed"
+	reasonDroppedFromQueue = "DroppedFromQueue"
+)
+
+// recordEvent records an event on ws, it does nothing if no recorder is configured.
+func (w *WSController) recordEvent(ws *v1.WebServerCluster, eventType, reason, messageFmt string,
+	args ...interface{}) {
+	if w.recorder == nil {
+		return
+	}
+	w.recorder.Eventf(w.newObjectReference(ws), eventType, reason, messageFmt, args...)
+}
+
+// recordEventByKey records an event on the WebServerCluster of key if it is still in the store.
+func (w *WSController) recordEventByKey(key interface{}, eventType, reason, messageFmt string,
+	args ...interface{}) {
+	obj, exists, err := w.store.GetByKey(key.(string))
+	if err != nil || !exists {
+		return
+	}
+	w.recordEvent(obj.(*v1.WebServerCluster), eventType, reason, messageFmt, args...)
+}
+
+func (w *WSController) newObjectReference(ws *v1.WebServerCluster) *apiv1.ObjectReference {
+	return &apiv1.ObjectReference{
+		Kind:            w.crd.Kind,
+		APIVersion:      w.crd.Group + "/" + w.crd.Version,
+		Namespace:       ws.ObjectMeta.Namespace,
+		Name:            ws.ObjectMeta.Name,
+		UID:             ws.UID,
+		ResourceVersion: ws.ResourceVersion,
+	}
+}
+
+// isDrift returns whether changes of the owned objects are made by others rather than spec changes,
+// i.e. the current spec has been reconciled.
+func isDrift(ws *v1.WebServerCluster) bool {
+	return isReconciled(ws) && ws.Status.ObservedGeneration == ws.Generation
+}
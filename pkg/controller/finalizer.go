@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+const (
+	// marks the deployments and services retained after their WebServerCluster is deleted
+	retainedAnnotationKey = "demo.io/retained"
+
+	reasonDeletionFailed = "DeletionFailed"
+)
+
+// finalizeWebServerCluster cleans up deployment and service of the deleting ws
+// by its deletion policy, and then removes the finalizer to release ws.
+func (w *WSController) finalizeWebServerCluster(ws *v1.WebServerCluster) error {
+	if !ws.HasFinalizer(v1.WebServerClusterFinalizer) {
+		return nil
+	}
+
+	var err error
+	switch policy := ws.Spec.GetDeletionPolicy(); policy {
+	case v1.DeletionPolicyDelete:
+		err = w.deleteWebServerCluster(ws)
+	case v1.DeletionPolicyOrphan, v1.DeletionPolicyRetain:
+		err = w.detachWebServerCluster(ws, policy)
+	default:
+		err = fmt.Errorf("unknown deletion policy %s", policy)
+	}
+	if err != nil {
+		w.recordEvent(ws, apiv1.EventTypeWarning, reasonDeletionFailed, "Failed to clean up by deletion policy %s: %v",
+			ws.Spec.GetDeletionPolicy(), err)
+		status := ws.Status
+		status.Conditions = append([]v1.WebServerClusterCondition{}, ws.Status.Conditions...)
+		v1.SetCondition(&status, v1.NewCondition(v1.WebServerClusterReconcileError, v1.ConditionTrue,
+			reasonDeletionFailed, err.Error()))
+		if statusErr := w.UpdateStatus(ws, &status); statusErr != nil {
+			w.logger.Warnf("Failed to update status of WebServerCluster %s: %v", ws.ObjectMeta.Name, statusErr)
+		}
+		return err
+	}
+
+	_, err = w.updateWebServerCluster(ws, func(wsCopy *v1.WebServerCluster) bool {
+		finalizers := []string{}
+		for _, f := range wsCopy.ObjectMeta.Finalizers {
+			if f != v1.WebServerClusterFinalizer {
+				finalizers = append(finalizers, f)
+			}
+		}
+		changed := len(finalizers) != len(wsCopy.ObjectMeta.Finalizers)
+		wsCopy.ObjectMeta.Finalizers = finalizers
+		return changed
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	w.logger.Infof("Successfully finalize WebServerCluster %s with deletion policy %s", ws.ObjectMeta.Name,
+		ws.Spec.GetDeletionPolicy())
+	w.recordEvent(ws, apiv1.EventTypeNormal, reasonDeleted, "Cleaned up deployment and service by deletion policy %s",
+		ws.Spec.GetDeletionPolicy())
+	return nil
+}
+
+// deleteWebServerCluster deletes deployments and services owned by ws.
+func (w *WSController) deleteWebServerCluster(ws *v1.WebServerCluster) error {
+	deploys, err := w.deployLister.ListByOwnerUID(ws.UID)
+	if err != nil {
+		return err
+	}
+	for _, deploy := range deploys {
+		deletePolicy := metav1.DeletePropagationBackground
+		deleteOptions := &metav1.DeleteOptions{
+			Preconditions:     metav1.NewUIDPreconditions(string(deploy.UID)),
+			PropagationPolicy: &deletePolicy,
+		}
+		if err := w.deployI.Delete(deploy.Namespace, deploy.Name, deleteOptions); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	svcs, err := w.svcLister.ListByOwnerUID(ws.UID)
+	if err != nil {
+		return err
+	}
+	for _, svc := range svcs {
+		err := w.svcI.Delete(svc.Namespace, svc.Name, metav1.NewPreconditionDeleteOptions(string(svc.UID)))
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	w.logger.Infof("Successfully delete web server cluster %s", ws.ObjectMeta.Name)
+	return nil
+}
+
+// detachWebServerCluster removes owner references of ws from its deployments and services,
+// so that they are not deleted with ws.
+func (w *WSController) detachWebServerCluster(ws *v1.WebServerCluster, policy v1.DeletionPolicy) error {
+	patch, err := newDetachPatch(ws, policy)
+	if err != nil {
+		return err
+	}
+
+	deploys, err := w.deployLister.ListByOwnerUID(ws.UID)
+	if err != nil {
+		return err
+	}
+	for _, deploy := range deploys {
+		_, err := w.deployI.Patch(deploy.Namespace, deploy.Name, types.StrategicMergePatchType, patch)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	svcs, err := w.svcLister.ListByOwnerUID(ws.UID)
+	if err != nil {
+		return err
+	}
+	for _, svc := range svcs {
+		_, err := w.svcI.Patch(svc.Namespace, svc.Name, types.StrategicMergePatchType, patch)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	w.logger.Infof("Successfully detach deployments and services from web server cluster %s", ws.ObjectMeta.Name)
+	return nil
+}
+
+// adoptObjectMeta clears the retained mark of objects adopted by a new WebServerCluster.
+func adoptObjectMeta(objMeta *metav1.ObjectMeta) bool {
+	if _, ok := objMeta.Annotations[retainedAnnotationKey]; !ok {
+		return false
+	}
+	delete(objMeta.Annotations, retainedAnnotationKey)
+	return true
+}
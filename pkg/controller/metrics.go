@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+	"github.com/mathspanda/ws-operator-demo/pkg/metrics"
+)
+
+const (
+	reconcileResultSuccess = "success"
+	// failed and requeued
+	reconcileResultRetry = "retry"
+	// failed too many times and dropped out of the queue
+	reconcileResultDropped = "dropped"
+)
+
+var (
+	reconcileDuration = metrics.NewHistogramVec("ws_operator_reconcile_duration_seconds",
+		"Duration in seconds of reconciling a WebServerCluster, partitioned by result.", nil, "result")
+	reconcileTotal = metrics.NewCounterVec("ws_operator_reconcile_total",
+		"Number of WebServerCluster reconciles, partitioned by result.", "result")
+)
+
+func init() {
+	metrics.MustRegister(reconcileDuration, reconcileTotal)
+}
+
+func observeReconcile(result string, duration time.Duration) {
+	reconcileDuration.WithLabelValues(result).Observe(duration.Seconds())
+	reconcileTotal.WithLabelValues(result).Inc()
+}
+
+// Collect implements metrics.Collector with WebServerClusters in the informer store,
+// so that deleted clusters disappear from metrics.
+func (w *WSController) Collect() []*metrics.Family {
+	byCondition := &metrics.Family{
+		Name: "ws_operator_webserverclusters",
+		Help: "Number of WebServerClusters, partitioned by condition type and status.",
+		Type: metrics.GaugeType,
+	}
+	desired := &metrics.Family{
+		Name: "ws_operator_webservercluster_desired_replicas",
+		Help: "Desired replicas of WebServerCluster.",
+		Type: metrics.GaugeType,
+	}
+	ready := &metrics.Family{
+		Name: "ws_operator_webservercluster_ready_replicas",
+		Help: "Ready replicas of WebServerCluster.",
+		Type: metrics.GaugeType,
+	}
+	families := []*metrics.Family{byCondition, desired, ready}
+	w.lock.Lock()
+	store := w.store
+	w.lock.Unlock()
+	if store == nil {
+		return families
+	}
+
+	conditionTypes := []v1.WebServerClusterConditionType{
+		v1.WebServerClusterAvailable,
+		v1.WebServerClusterProgressing,
+		v1.WebServerClusterDegraded,
+		v1.WebServerClusterReconcileError,
+	}
+	statuses := []v1.ConditionStatus{v1.ConditionTrue, v1.ConditionFalse, v1.ConditionUnknown}
+	counts := map[v1.WebServerClusterConditionType]map[v1.ConditionStatus]int{}
+	for _, t := range conditionTypes {
+		counts[t] = map[v1.ConditionStatus]int{}
+	}
+
+	for _, obj := range store.List() {
+		ws, ok := obj.(*v1.WebServerCluster)
+		if !ok || !w.ServesNamespace(ws.ObjectMeta.Namespace) {
+			continue
+		}
+		for _, c := range ws.Status.Conditions {
+			if _, ok := counts[c.Type]; ok {
+				counts[c.Type][c.Status]++
+			}
+		}
+
+		labels := []metrics.LabelPair{
+			{Name: "namespace", Value: ws.ObjectMeta.Namespace},
+			{Name: "name", Value: ws.ObjectMeta.Name},
+		}
+		desired.Samples = append(desired.Samples, metrics.Sample{Labels: labels,
+			Value: float64(w.desiredReplicasOf(ws))})
+		ready.Samples = append(ready.Samples, metrics.Sample{Labels: labels,
+			Value: float64(ws.Status.ReadyReplicas)})
+	}
+
+	for _, t := range conditionTypes {
+		for _, status := range statuses {
+			byCondition.Samples = append(byCondition.Samples, metrics.Sample{
+				Labels: []metrics.LabelPair{
+					{Name: "condition", Value: string(t)},
+					{Name: "status", Value: string(status)},
+				},
+				Value: float64(counts[t][status]),
+			})
+		}
+	}
+	return families
+}
+
+// desiredReplicasOf returns the replicas of ws, or the ones of its deployment if unspecified,
+// which may be scaled by others, e.g. HPA.
+func (w *WSController) desiredReplicasOf(ws *v1.WebServerCluster) int32 {
+	if ws.Spec.Replicas == nil && w.deployLister != nil {
+		if deploy, err := w.deployLister.Get(ws.ObjectMeta.Namespace, ws.ObjectMeta.Name); err == nil {
+			return desiredReplicas(deploy.Spec.Replicas)
+		}
+	}
+	return desiredReplicas(ws.Spec.Replicas)
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+func newOwnershipLabels(ws *v1.WebServerCluster) map[string]string {
+	return map[string]string{
+		OwnerLabelKey:     ws.ObjectMeta.Name,
+		ManagedByLabelKey: ManagedByLabel,
+	}
+}
+
+// mergeLabels sets labels on objMeta, and returns whether objMeta is changed.
+func mergeLabels(objMeta *metav1.ObjectMeta, labels map[string]string) bool {
+	changed := false
+	for k, v := range labels {
+		if objMeta.Labels[k] == v {
+			continue
+		}
+		if objMeta.Labels == nil {
+			objMeta.Labels = map[string]string{}
+		}
+		objMeta.Labels[k] = v
+		changed = true
+	}
+	return changed
+}
+
+// mergeOwnerReferences sets owners on objMeta by uid and keeps the other owners,
+// and returns whether objMeta is changed.
+func mergeOwnerReferences(objMeta *metav1.ObjectMeta, owners []metav1.OwnerReference) bool {
+	changed := false
+	for _, owner := range owners {
+		found := false
+		for i := range objMeta.OwnerReferences {
+			if objMeta.OwnerReferences[i].UID != owner.UID {
+				continue
+			}
+			found = true
+			if !reflect.DeepEqual(objMeta.OwnerReferences[i], owner) {
+				objMeta.OwnerReferences[i] = owner
+				changed = true
+			}
+		}
+		if !found {
+			objMeta.OwnerReferences = append(objMeta.OwnerReferences, owner)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// SweepOrphans deletes the deployments and services created by operator whose
+// WebServerCluster no longer exists, e.g. deleted while operator is down.
+// It must be called after the WebServerCluster store is synced, and only sweeps
+// served namespaces.
+func (w *WSController) SweepOrphans() error {
+	errs := []error{}
+
+	deploys, err := w.deployI.List(w.namespace, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range deploys.Items {
+		deploy := &deploys.Items[i]
+		if w.ServesNamespace(deploy.Namespace) && w.isOrphan(&deploy.ObjectMeta) {
+			w.logger.Infof("Delete orphan deployment %s/%s", deploy.Namespace, deploy.Name)
+			deletePolicy := metav1.DeletePropagationBackground
+			err := w.deployI.Delete(deploy.Namespace, deploy.Name, &metav1.DeleteOptions{
+				Preconditions:     metav1.NewUIDPreconditions(string(deploy.UID)),
+				PropagationPolicy: &deletePolicy,
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	svcs, err := w.svcI.List(w.namespace, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range svcs.Items {
+		svc := &svcs.Items[i]
+		if w.ServesNamespace(svc.Namespace) && w.isOrphan(&svc.ObjectMeta) {
+			w.logger.Infof("Delete orphan service %s/%s", svc.Namespace, svc.Name)
+			err := w.svcI.Delete(svc.Namespace, svc.Name, metav1.NewPreconditionDeleteOptions(string(svc.UID)))
+			if err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// isOrphan returns whether the object is created by operator, and its WebServerCluster no longer exists.
+// The store only caches WebServerClusters served by this instance, which are filtered by selector
+// or shard, so WebServerClusters missing in the store are confirmed with api server.
+func (w *WSController) isOrphan(objMeta *metav1.ObjectMeta) bool {
+	if _, ok := objMeta.Annotations[retainedAnnotationKey]; ok {
+		return false
+	}
+	owners := map[string]types.UID{}
+	if objMeta.Labels[ManagedByLabelKey] == ManagedByLabel && objMeta.Labels[OwnerLabelKey] != "" {
+		owners[objMeta.Labels[OwnerLabelKey]] = ""
+	}
+	apiVersion := w.crd.Group + "/" + w.crd.Version
+	for _, owner := range objMeta.OwnerReferences {
+		if owner.Kind == w.crd.Kind && owner.APIVersion == apiVersion {
+			owners[owner.Name] = owner.UID
+		}
+	}
+	if len(owners) == 0 {
+		return false
+	}
+
+	for name, uid := range owners {
+		obj, exists, err := w.store.GetByKey(objMeta.Namespace + "/" + name)
+		if err != nil {
+			return false
+		}
+		if exists && (uid == "" || obj.(*v1.WebServerCluster).UID == uid) {
+			return false
+		}
+	}
+
+	for name, uid := range owners {
+		ws, err := w.getWebServerCluster(objMeta.Namespace, name)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil || uid == "" || ws.UID == uid {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+// Strategic merge patches only carry the fields owned by operator, so that labels, annotations,
+// containers and other fields set by others are preserved, and no resourceVersion is needed.
+
+// directive of strategic merge patch, as the first element of a list or a key of a map
+const patchDirectiveKey = "$patch"
+
+// snapshotMeta copies labels and annotations of objMeta, which are diffed with the updated ones.
+func snapshotMeta(objMeta *metav1.ObjectMeta) *metav1.ObjectMeta {
+	return &metav1.ObjectMeta{
+		Labels:      copyStringMap(objMeta.Labels),
+		Annotations: copyStringMap(objMeta.Annotations),
+	}
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// newMapPatch returns the changed and added keys from original to updated, and removed keys as null.
+func newMapPatch(original, updated map[string]string) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for k, v := range updated {
+		if ov, ok := original[k]; !ok || ov != v {
+			patch[k] = v
+		}
+	}
+	for k := range original {
+		if _, ok := updated[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
+
+// newMetaPatch patches labels and annotations changed from original, and merges owner references by uid.
+func newMetaPatch(original, updated *metav1.ObjectMeta) map[string]interface{} {
+	patch := map[string]interface{}{}
+	if labels := newMapPatch(original.Labels, updated.Labels); len(labels) > 0 {
+		patch["labels"] = labels
+	}
+	if annotations := newMapPatch(original.Annotations, updated.Annotations); len(annotations) > 0 {
+		patch["annotations"] = annotations
+	}
+	if len(updated.OwnerReferences) > 0 {
+		patch["ownerReferences"] = updated.OwnerReferences
+	}
+	return patch
+}
+
+// newReplaceMap replaces the whole map instead of merging it.
+func newReplaceMap(m map[string]string) map[string]interface{} {
+	patch := map[string]interface{}{patchDirectiveKey: "replace"}
+	for k, v := range m {
+		patch[k] = v
+	}
+	return patch
+}
+
+// newDeploymentPatch returns the patch of the owned fields of updated deployment,
+// original is the snapshot of its metadata before update. Replicas are owned only if
+// they are specified by WebServerCluster.
+func newDeploymentPatch(original *metav1.ObjectMeta, updated *extensionsv1beta1.Deployment,
+	ownReplicas bool) ([]byte, error) {
+	containers := []interface{}{}
+	for _, c := range updated.Spec.Template.Spec.Containers {
+		ports := []interface{}{map[string]interface{}{patchDirectiveKey: "replace"}}
+		for _, p := range c.Ports {
+			ports = append(ports, p)
+		}
+		containers = append(containers, map[string]interface{}{
+			"name":  c.Name,
+			"image": c.Image,
+			"ports": ports,
+		})
+	}
+
+	spec := map[string]interface{}{
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": updated.Spec.Template.Labels,
+			},
+			"spec": map[string]interface{}{
+				"containers": containers,
+			},
+		},
+	}
+	// replicas are left to others, e.g. HPA scaling the deployment, if unspecified
+	if ownReplicas && updated.Spec.Replicas != nil {
+		spec["replicas"] = *updated.Spec.Replicas
+	}
+	if updated.Spec.Selector != nil {
+		spec["selector"] = map[string]interface{}{
+			"matchLabels": newReplaceMap(updated.Spec.Selector.MatchLabels),
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"metadata": newMetaPatch(original, &updated.ObjectMeta),
+		"spec":     spec,
+	})
+}
+
+// newServicePatch returns the patch of the owned fields of updated service,
+// original is the snapshot of its metadata before update.
+func newServicePatch(original *metav1.ObjectMeta, updated *apiv1.Service) ([]byte, error) {
+	ports := []interface{}{map[string]interface{}{patchDirectiveKey: "replace"}}
+	for _, p := range updated.Spec.Ports {
+		ports = append(ports, p)
+	}
+
+	spec := map[string]interface{}{
+		"type":     updated.Spec.Type,
+		"ports":    ports,
+		"selector": newReplaceMap(updated.Spec.Selector),
+		// unset fields are removed, e.g. externalTrafficPolicy when switching to ClusterIP
+		"sessionAffinity":          nil,
+		"loadBalancerSourceRanges": nil,
+		"externalTrafficPolicy":    nil,
+		"healthCheckNodePort":      nil,
+	}
+	if updated.Spec.SessionAffinity != "" {
+		spec["sessionAffinity"] = updated.Spec.SessionAffinity
+	}
+	if len(updated.Spec.LoadBalancerSourceRanges) > 0 {
+		spec["loadBalancerSourceRanges"] = updated.Spec.LoadBalancerSourceRanges
+	}
+	if updated.Spec.ExternalTrafficPolicy != "" {
+		spec["externalTrafficPolicy"] = updated.Spec.ExternalTrafficPolicy
+	}
+	if updated.Spec.HealthCheckNodePort != 0 {
+		spec["healthCheckNodePort"] = updated.Spec.HealthCheckNodePort
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"metadata": newMetaPatch(original, &updated.ObjectMeta),
+		"spec":     spec,
+	})
+}
+
+// newDetachPatch removes the owner reference of ws. Orphaned objects also lose ownership
+// labels, while retained ones keep them to be adopted later.
+func newDetachPatch(ws *v1.WebServerCluster, policy v1.DeletionPolicy) ([]byte, error) {
+	objMeta := map[string]interface{}{
+		"ownerReferences": []interface{}{
+			map[string]interface{}{patchDirectiveKey: "delete", "uid": ws.UID},
+		},
+	}
+	if policy == v1.DeletionPolicyOrphan {
+		objMeta["labels"] = map[string]interface{}{
+			OwnerLabelKey:     nil,
+			ManagedByLabelKey: nil,
+		}
+	} else {
+		objMeta["annotations"] = map[string]interface{}{
+			retainedAnnotationKey: "true",
+		}
+	}
+	return json.Marshal(map[string]interface{}{"metadata": objMeta})
+}
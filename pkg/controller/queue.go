@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// trackingQueue records the queued and processing keys of the wrapped queue,
+// which workqueue does not expose, for health checks and debugging.
+type trackingQueue struct {
+	workqueue.RateLimitingInterface
+
+	lock sync.Mutex
+	// keys added and not yet got by workers, including the rate limited ones
+	queued map[interface{}]time.Time
+	// keys being processed by workers, and since when
+	processing map[interface{}]time.Time
+}
+
+func newTrackingQueue(queue workqueue.RateLimitingInterface) *trackingQueue {
+	return &trackingQueue{
+		RateLimitingInterface: queue,
+		queued:                map[interface{}]time.Time{},
+		processing:            map[interface{}]time.Time{},
+	}
+}
+
+func (q *trackingQueue) Add(item interface{}) {
+	q.markQueued(item)
+	q.RateLimitingInterface.Add(item)
+}
+
+func (q *trackingQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.markQueued(item)
+	q.RateLimitingInterface.AddAfter(item, duration)
+}
+
+func (q *trackingQueue) AddRateLimited(item interface{}) {
+	q.markQueued(item)
+	q.RateLimitingInterface.AddRateLimited(item)
+}
+
+func (q *trackingQueue) Get() (interface{}, bool) {
+	item, quit := q.RateLimitingInterface.Get()
+	if quit {
+		return item, quit
+	}
+	q.lock.Lock()
+	delete(q.queued, item)
+	q.processing[item] = time.Now()
+	q.lock.Unlock()
+	return item, quit
+}
+
+func (q *trackingQueue) Done(item interface{}) {
+	q.lock.Lock()
+	delete(q.processing, item)
+	q.lock.Unlock()
+	q.RateLimitingInterface.Done(item)
+}
+
+func (q *trackingQueue) markQueued(item interface{}) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if _, ok := q.queued[item]; !ok {
+		q.queued[item] = time.Now()
+	}
+}
+
+// QueueItem is a key in the queue, and since when it is queued or processed.
+type QueueItem struct {
+	Key   string    `json:"key"`
+	Since time.Time `json:"since"`
+}
+
+type QueueDump struct {
+	Queued     []QueueItem `json:"queued"`
+	Processing []QueueItem `json:"processing"`
+}
+
+func (q *trackingQueue) dump() *QueueDump {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return &QueueDump{
+		Queued:     newQueueItems(q.queued),
+		Processing: newQueueItems(q.processing),
+	}
+}
+
+// oldestProcessing returns the key processed for the longest time, and since when.
+func (q *trackingQueue) oldestProcessing() (interface{}, time.Time, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var oldest interface{}
+	var since time.Time
+	found := false
+	for item, start := range q.processing {
+		if !found || start.Before(since) {
+			oldest, since, found = item, start, true
+		}
+	}
+	return oldest, since, found
+}
+
+func newQueueItems(items map[interface{}]time.Time) []QueueItem {
+	result := make([]QueueItem, 0, len(items))
+	for item, since := range items {
+		result = append(result, QueueItem{Key: fmt.Sprint(item), Since: since})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Since.Before(result[j].Since)
+	})
+	return result
+}
+
+// DumpQueue returns the queued and processing WebServerCluster keys.
+func (w *WSController) DumpQueue() *QueueDump {
+	return w.queue.dump()
+}
+
+// CheckWorkers returns an error if a worker has been reconciling a WebServerCluster longer than timeout.
+func (w *WSController) CheckWorkers(timeout time.Duration) error {
+	key, since, ok := w.queue.oldestProcessing()
+	if !ok {
+		return nil
+	}
+	if elapsed := time.Since(since); elapsed > timeout {
+		return fmt.Errorf("worker is stuck reconciling WebServerCluster %v for %v", key, elapsed)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"errors"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+	"github.com/mathspanda/ws-operator-demo/pkg/k8s"
+)
+
+// Render returns the deployment and service which reconcile creates for ws, by the same code paths
+// but without contacting api server. Defaults are applied on ws spec as initWebServerCluster does,
+// and default replicas on the deployment as it is created.
+func Render(crd *k8s.CRD, defaults *v1.WebServerClusterDefaults,
+	ws *v1.WebServerCluster) (*extensionsv1beta1.Deployment, *apiv1.Service, error) {
+	if ws.ObjectMeta.Name == "" {
+		return nil, nil, errors.New("metadata.name is required")
+	}
+	v1.SetDefaults(&ws.Spec, defaults)
+	if ws.Spec.Image == "" {
+		return nil, nil, errors.New("spec.image is required, and no default image is configured")
+	}
+
+	// clients are never called by the builders of desired objects
+	w := &WSController{
+		crd:      crd,
+		defaults: defaults,
+		deployI:  k8s.NewDeployment(nil),
+		svcI:     k8s.NewService(nil),
+	}
+	deploy := w.withDefaultReplicas(w.newDesiredDeployment(ws))
+	deploy.TypeMeta = metav1.TypeMeta{APIVersion: "extensions/v1beta1", Kind: "Deployment"}
+	svc := w.newDesiredService(ws)
+	svc.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Service"}
+	return deploy, svc, nil
+}
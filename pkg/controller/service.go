@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+// reconcileService makes the live service of ws match the desired one, the service
+// is updated in place unless an immutable field changes.
+func (w *WSController) reconcileService(ws *v1.WebServerCluster) error {
+	desired := w.newDesiredService(ws)
+
+	live, err := w.svcLister.Get(ws.ObjectMeta.Namespace, ws.ObjectMeta.Name)
+	if apierrors.IsNotFound(err) {
+		_, err = w.svcI.Create(desired)
+		if err == nil {
+			if isReconciled(ws) {
+				w.logger.Warnf("Restore deleted service %s of WebServerCluster %s", desired.Name, ws.ObjectMeta.Name)
+				w.recordEvent(ws, apiv1.EventTypeNormal, reasonDriftCorrected, "Restored deleted service %s",
+					desired.Name)
+			} else {
+				w.recordEvent(ws, apiv1.EventTypeNormal, reasonCreated, "Created service %s", desired.Name)
+			}
+			return nil
+		}
+		// the informer has not seen it yet, or it is not labeled by operator, read it from api server
+		if apierrors.IsAlreadyExists(err) {
+			live, err = w.svcI.Get(ws.ObjectMeta.Namespace, ws.ObjectMeta.Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if reason := immutableServiceChange(live, desired); reason != "" {
+		w.logger.Infof("Recreate service %s: %s", live.Name, reason)
+		if err := w.svcI.Delete(live.Namespace, live.Name, metav1.NewPreconditionDeleteOptions(string(live.UID))); err != nil &&
+			!apierrors.IsNotFound(err) {
+			return err
+		}
+		if _, err = w.svcI.Create(desired); err != nil {
+			return err
+		}
+		w.recordEvent(ws, apiv1.EventTypeNormal, reasonUpdated, "Recreated service %s: %s", live.Name, reason)
+		return nil
+	}
+
+	original := snapshotMeta(&live.ObjectMeta)
+	changed := updateService(live, desired)
+	if len(changed) == 0 {
+		return nil
+	}
+	patch, err := newServicePatch(original, live)
+	if err != nil {
+		return err
+	}
+	if _, err = w.svcI.Patch(live.Namespace, live.Name, types.StrategicMergePatchType, patch); err != nil {
+		return err
+	}
+	w.logger.Infof("Successfully update service %s, changed fields: %v", live.Name, changed)
+	if isDrift(ws) {
+		w.recordEvent(ws, apiv1.EventTypeNormal, reasonDriftCorrected, "Reverted drifted fields %v of service %s",
+			changed, live.Name)
+	} else {
+		w.recordEvent(ws, apiv1.EventTypeNormal, reasonUpdated, "Updated fields %v of service %s",
+			changed, live.Name)
+	}
+	return nil
+}
+
+// immutableServiceChange returns why the live service can't be updated to the desired one.
+func immutableServiceChange(live, desired *apiv1.Service) string {
+	liveHeadless := live.Spec.ClusterIP == apiv1.ClusterIPNone
+	desiredHeadless := desired.Spec.ClusterIP == apiv1.ClusterIPNone
+	if liveHeadless != desiredHeadless {
+		return fmt.Sprintf("clusterIP changes from %q to %q", live.Spec.ClusterIP, desired.Spec.ClusterIP)
+	}
+	return ""
+}
+
+// updateService sets the fields owned by operator from desired service on live one,
+// keeps the fields allocated by kubernetes, and returns the changed fields of live service.
+// The owned fields of updated live service are then sent as a patch.
+func updateService(live, desired *apiv1.Service) []string {
+	changed := []string{}
+
+	if mergeLabels(&live.ObjectMeta, desired.Labels) {
+		changed = append(changed, "metadata.labels")
+	}
+	if adoptObjectMeta(&live.ObjectMeta) {
+		changed = append(changed, "metadata.annotations")
+	}
+	annotations := mergeManagedAnnotations(live.Annotations, desired.Annotations)
+	if !(len(annotations) == 0 && len(live.Annotations) == 0) &&
+		!reflect.DeepEqual(annotations, live.Annotations) {
+		live.Annotations = annotations
+		changed = append(changed, "metadata.annotations")
+	}
+	if mergeOwnerReferences(&live.ObjectMeta, desired.OwnerReferences) {
+		changed = append(changed, "metadata.ownerReferences")
+	}
+
+	spec := desired.Spec
+	spec.ClusterIP = live.Spec.ClusterIP
+	spec.ExternalIPs = live.Spec.ExternalIPs
+	spec.LoadBalancerIP = live.Spec.LoadBalancerIP
+
+	exposed := spec.Type == apiv1.ServiceTypeNodePort || spec.Type == apiv1.ServiceTypeLoadBalancer
+	if exposed {
+		for i := range spec.Ports {
+			if spec.Ports[i].NodePort != 0 {
+				continue
+			}
+			if livePort := findServicePort(live.Spec.Ports, &spec.Ports[i]); livePort != nil {
+				spec.Ports[i].NodePort = livePort.NodePort
+			}
+		}
+		if spec.ExternalTrafficPolicy == "" {
+			spec.ExternalTrafficPolicy = live.Spec.ExternalTrafficPolicy
+		}
+	}
+	if spec.Type == apiv1.ServiceTypeLoadBalancer &&
+		spec.ExternalTrafficPolicy == apiv1.ServiceExternalTrafficPolicyTypeLocal {
+		spec.HealthCheckNodePort = live.Spec.HealthCheckNodePort
+	}
+
+	if fields := diffServiceSpec(&live.Spec, &spec); len(fields) > 0 {
+		changed = append(changed, fields...)
+		live.Spec = spec
+	}
+	return changed
+}
+
+// diffServiceSpec returns the changed fields owned by operator.
+func diffServiceSpec(live, desired *apiv1.ServiceSpec) []string {
+	fields := []string{}
+	if live.Type != desired.Type {
+		fields = append(fields, "spec.type")
+	}
+	if !reflect.DeepEqual(live.Ports, desired.Ports) {
+		fields = append(fields, "spec.ports")
+	}
+	if !reflect.DeepEqual(live.Selector, desired.Selector) {
+		fields = append(fields, "spec.selector")
+	}
+	if live.SessionAffinity != desired.SessionAffinity {
+		fields = append(fields, "spec.sessionAffinity")
+	}
+	if !reflect.DeepEqual(live.LoadBalancerSourceRanges, desired.LoadBalancerSourceRanges) {
+		fields = append(fields, "spec.loadBalancerSourceRanges")
+	}
+	if live.ExternalTrafficPolicy != desired.ExternalTrafficPolicy {
+		fields = append(fields, "spec.externalTrafficPolicy")
+	}
+	if live.HealthCheckNodePort != desired.HealthCheckNodePort {
+		fields = append(fields, "spec.healthCheckNodePort")
+	}
+	return fields
+}
+
+// findServicePort finds the port matching name, or port and protocol if unnamed.
+func findServicePort(ports []apiv1.ServicePort, port *apiv1.ServicePort) *apiv1.ServicePort {
+	for i := range ports {
+		if port.Name != "" && ports[i].Name == port.Name {
+			return &ports[i]
+		}
+		if port.Name == "" && ports[i].Port == port.Port && ports[i].Protocol == port.Protocol {
+			return &ports[i]
+		}
+	}
+	return nil
+}
+
+// newDesiredService returns the service which operator creates for ws.
+func (w *WSController) newDesiredService(ws *v1.WebServerCluster) *apiv1.Service {
+	desired := w.svcI.MakeConfig(w.newWebServerClusterServiceData(ws))
+	desired.Annotations = mergeManagedAnnotations(nil, desired.Annotations)
+	desired.OwnerReferences = []metav1.OwnerReference{w.newOwnerRefOfWebServerCluster(ws)}
+	return desired
+}
+
+// mergeManagedAnnotations sets the desired annotations on current ones, and removes
+// the annotations set by operator before but no longer desired.
+func mergeManagedAnnotations(current, desired map[string]string) map[string]string {
+	merged := map[string]string{}
+	for k, v := range current {
+		merged[k] = v
+	}
+	if managed, ok := current[managedAnnotationsKey]; ok && managed != "" {
+		for _, k := range strings.Split(managed, ",") {
+			delete(merged, k)
+		}
+	}
+	delete(merged, managedAnnotationsKey)
+
+	keys := make([]string, 0, len(desired))
+	for k, v := range desired {
+		merged[k] = v
+		keys = append(keys, k)
+	}
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		merged[managedAnnotationsKey] = strings.Join(keys, ",")
+	}
+	return merged
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+const (
+	reasonMinimumReplicasAvailable   = "MinimumReplicasAvailable"
+	reasonMinimumReplicasUnavailable = "MinimumReplicasUnavailable"
+	reasonRolloutInProgress          = "RolloutInProgress"
+	reasonRolloutComplete            = "RolloutComplete"
+	reasonDeploymentHealthy          = "DeploymentHealthy"
+	reasonReconcileSucceeded         = "ReconcileSucceeded"
+	reasonReconcileFailed            = "ReconcileFailed"
+)
+
+// desiredReplicas returns replicas, which kubernetes defaults to 1 for deployments if unspecified.
+func desiredReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// NewWebServerClusterStatus computes the status of web server cluster from its owned deployment.
+func NewWebServerClusterStatus(ws *v1.WebServerCluster, deploy *extensionsv1beta1.Deployment) *v1.WebServerClusterStatus {
+	desired := desiredReplicas(deploy.Spec.Replicas)
+	deployStatus := deploy.Status
+
+	status := &v1.WebServerClusterStatus{
+		ObservedGeneration: ws.Generation,
+		Replicas:           deployStatus.Replicas,
+		ReadyReplicas:      deployStatus.ReadyReplicas,
+		UpdatedReplicas:    deployStatus.UpdatedReplicas,
+		AvailableReplicas:  deployStatus.AvailableReplicas,
+	}
+	if selector, err := metav1.LabelSelectorAsSelector(deploy.Spec.Selector); err == nil {
+		status.Selector = selector.String()
+	}
+
+	if deployStatus.AvailableReplicas >= desired {
+		v1.SetCondition(status, v1.NewCondition(v1.WebServerClusterAvailable, v1.ConditionTrue,
+			reasonMinimumReplicasAvailable,
+			fmt.Sprintf("%d/%d replicas available", deployStatus.AvailableReplicas, desired)))
+	} else {
+		v1.SetCondition(status, v1.NewCondition(v1.WebServerClusterAvailable, v1.ConditionFalse,
+			reasonMinimumReplicasUnavailable,
+			fmt.Sprintf("%d/%d replicas available", deployStatus.AvailableReplicas, desired)))
+	}
+
+	if deployStatus.ObservedGeneration < deploy.Generation ||
+		deployStatus.UpdatedReplicas < desired ||
+		deployStatus.Replicas > deployStatus.UpdatedReplicas ||
+		deployStatus.AvailableReplicas < deployStatus.UpdatedReplicas {
+		v1.SetCondition(status, v1.NewCondition(v1.WebServerClusterProgressing, v1.ConditionTrue,
+			reasonRolloutInProgress,
+			fmt.Sprintf("%d/%d replicas updated", deployStatus.UpdatedReplicas, desired)))
+	} else {
+		v1.SetCondition(status, v1.NewCondition(v1.WebServerClusterProgressing, v1.ConditionFalse,
+			reasonRolloutComplete, "deployment is up to date"))
+	}
+
+	degraded := v1.NewCondition(v1.WebServerClusterDegraded, v1.ConditionFalse, reasonDeploymentHealthy, "")
+	for _, cond := range deployStatus.Conditions {
+		switch {
+		case cond.Type == extensionsv1beta1.DeploymentReplicaFailure && cond.Status == apiv1.ConditionTrue,
+			cond.Type == extensionsv1beta1.DeploymentProgressing && cond.Status == apiv1.ConditionFalse:
+			degraded = v1.NewCondition(v1.WebServerClusterDegraded, v1.ConditionTrue, cond.Reason, cond.Message)
+		}
+	}
+	v1.SetCondition(status, degraded)
+
+	return status
+}
+
+// mergeStatus applies the new status on top of the old one, keeping conditions
+// which the new status does not carry and their lastTransitionTime if unchanged.
+func mergeStatus(old *v1.WebServerClusterStatus, status *v1.WebServerClusterStatus) v1.WebServerClusterStatus {
+	merged := *status
+	merged.Conditions = make([]v1.WebServerClusterCondition, len(old.Conditions))
+	copy(merged.Conditions, old.Conditions)
+	for _, cond := range status.Conditions {
+		v1.SetCondition(&merged, cond)
+	}
+	return merged
+}
+
+func newReconcileCondition(err error) v1.WebServerClusterCondition {
+	if err != nil {
+		return v1.NewCondition(v1.WebServerClusterReconcileError, v1.ConditionTrue,
+			reasonReconcileFailed, err.Error())
+	}
+	return v1.NewCondition(v1.WebServerClusterReconcileError, v1.ConditionFalse,
+		reasonReconcileSucceeded, "")
+}
@@ -1,6 +1,7 @@
 package k8s
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -24,33 +25,69 @@ type CRD struct {
 	Group         string
 	Version       string
 	Scope         apiextensionsv1beta1.ResourceScope
+	Subresources  *CustomResourceSubresources
 	Obj           runtime.Object
 	ObjList       runtime.Object
 	SchemeBuilder func(*runtime.Scheme) error
 }
 
+// The vendored apiextensions types predate CRD subresources, so CRD objects
+// are built and sent with the local types below, which extend the vendored ones.
+type CustomResourceDefinition struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CustomResourceDefinitionSpec                        `json:"spec"`
+	Status apiextensionsv1beta1.CustomResourceDefinitionStatus `json:"status,omitempty"`
+}
+
+type CustomResourceDefinitionSpec struct {
+	apiextensionsv1beta1.CustomResourceDefinitionSpec `json:",inline"`
+
+	Validation   *CustomResourceValidation   `json:"validation,omitempty"`
+	Subresources *CustomResourceSubresources `json:"subresources,omitempty"`
+}
+
+type CustomResourceSubresources struct {
+	Status *CustomResourceSubresourceStatus `json:"status,omitempty"`
+	Scale  *CustomResourceSubresourceScale  `json:"scale,omitempty"`
+}
+
+type CustomResourceSubresourceStatus struct{}
+
+type CustomResourceSubresourceScale struct {
+	SpecReplicasPath   string  `json:"specReplicasPath"`
+	StatusReplicasPath string  `json:"statusReplicasPath"`
+	LabelSelectorPath  *string `json:"labelSelectorPath,omitempty"`
+}
+
 type CRDData struct {
 	Name string
-	Spec apiextensionsv1beta1.CustomResourceDefinitionSpec
+	Spec CustomResourceDefinitionSpec
 }
 
 func NewCRDData(config *CRD) *CRDData {
 	return &CRDData{
 		Name: config.Name,
-		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
-			Group:   config.Group,
-			Version: config.Version,
-			Scope:   apiextensionsv1beta1.NamespaceScoped,
-			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
-				Kind:   config.Kind,
-				Plural: config.Plural,
+		Spec: CustomResourceDefinitionSpec{
+			CustomResourceDefinitionSpec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+				Group:   config.Group,
+				Version: config.Version,
+				Scope:   apiextensionsv1beta1.NamespaceScoped,
+				Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+					Kind:   config.Kind,
+					Plural: config.Plural,
+				},
 			},
+			Validation:   NewCRDValidation(config.Obj),
+			Subresources: config.Subresources,
 		},
 	}
 }
 
 type crds struct {
-	client v1beta1.CustomResourceDefinitionInterface
+	client     v1beta1.CustomResourceDefinitionInterface
+	restClient rest.Interface
 }
 
 type CRDRestClientConfig struct {
@@ -60,20 +97,37 @@ type CRDRestClientConfig struct {
 
 func NewCRD(clientset apiextensionsclient.Interface) CRDInterface {
 	return &crds{
-		client: clientset.ApiextensionsV1beta1().CustomResourceDefinitions(),
+		client:     clientset.ApiextensionsV1beta1().CustomResourceDefinitions(),
+		restClient: clientset.ApiextensionsV1beta1().RESTClient(),
 	}
 }
 
 type CRDInterface interface {
-	MakeConfig(*CRDData) *apiextensionsv1beta1.CustomResourceDefinition
-	Create(*apiextensionsv1beta1.CustomResourceDefinition) (*apiextensionsv1beta1.CustomResourceDefinition, error)
+	MakeConfig(*CRDData) *CustomResourceDefinition
+	// Create creates the crd and waits for it to be established, an existing crd is updated if
+	// its validation or subresources are outdated
+	Create(*CustomResourceDefinition) (*CustomResourceDefinition, error)
+	// Update replaces the spec of the live crd, and waits for it to be established
+	Update(*CustomResourceDefinition) (*CustomResourceDefinition, error)
+	Get(string) (*CustomResourceDefinition, error)
 	Delete(string, *metav1.DeleteOptions) error
+	// WaitEstablished waits for the crd to be established, it fails if the crd does not exist
+	WaitEstablished(string) error
 
 	NewRestClient(*CRDRestClientConfig) (*rest.RESTClient, *runtime.Scheme, error)
 }
 
-func (c *crds) MakeConfig(rawData *CRDData) *apiextensionsv1beta1.CustomResourceDefinition {
-	return &apiextensionsv1beta1.CustomResourceDefinition{
+func (c *crds) MakeConfig(rawData *CRDData) *CustomResourceDefinition {
+	return MakeCRDConfig(rawData)
+}
+
+// MakeCRDConfig builds the crd object of rawData without a client, e.g. to print it.
+func MakeCRDConfig(rawData *CRDData) *CustomResourceDefinition {
+	return &CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CustomResourceDefinition",
+			APIVersion: apiextensionsv1beta1.SchemeGroupVersion.String(),
+		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name: rawData.Name,
 		},
@@ -81,11 +135,18 @@ func (c *crds) MakeConfig(rawData *CRDData) *apiextensionsv1beta1.CustomResource
 	}
 }
 
-func (c *crds) Create(crdConfig *apiextensionsv1beta1.CustomResourceDefinition) (*apiextensionsv1beta1.CustomResourceDefinition, error) {
-	crd, err := c.client.Create(crdConfig)
+func (c *crds) Create(crdConfig *CustomResourceDefinition) (*CustomResourceDefinition, error) {
+	body, err := json.Marshal(crdConfig)
+	if err != nil {
+		return nil, err
+	}
+	crd, err := c.decode(c.restClient.Post().
+		Resource("customresourcedefinitions").
+		Body(body).
+		DoRaw())
 	if err != nil {
 		if apierrors.IsAlreadyExists(err) {
-			return c.client.Get(crdConfig.ObjectMeta.Name, metav1.GetOptions{})
+			return c.upgrade(crdConfig)
 		}
 		return nil, err
 	}
@@ -101,10 +162,91 @@ func (c *crds) Create(crdConfig *apiextensionsv1beta1.CustomResourceDefinition)
 	return crd, nil
 }
 
+// upgrade updates the live crd if its validation or subresources differ from crdConfig, e.g. if it is
+// created by an older operator, and returns the live crd otherwise.
+func (c *crds) upgrade(crdConfig *CustomResourceDefinition) (*CustomResourceDefinition, error) {
+	live, err := c.get(crdConfig.ObjectMeta.Name)
+	if err != nil {
+		return nil, err
+	}
+	if jsonEqual(live.Spec.Validation, crdConfig.Spec.Validation) &&
+		jsonEqual(live.Spec.Subresources, crdConfig.Spec.Subresources) {
+		return live, nil
+	}
+	crd, err := c.Update(crdConfig)
+	if err != nil {
+		return nil, fmt.Errorf("crd %s is outdated and fails to be updated, upgrade it by `crd upgrade`: %v",
+			crdConfig.ObjectMeta.Name, err)
+	}
+	return crd, nil
+}
+
+// jsonEqual compares a and b by their json encodings, so that empty fields omitted by api server are equal.
+func jsonEqual(a, b interface{}) bool {
+	aBytes, aErr := json.Marshal(a)
+	bBytes, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && string(aBytes) == string(bBytes)
+}
+
+func (c *crds) Update(crdConfig *CustomResourceDefinition) (*CustomResourceDefinition, error) {
+	var crd *CustomResourceDefinition
+	err := RetryOnConflict(DefaultRetry, func() error {
+		live, err := c.get(crdConfig.ObjectMeta.Name)
+		if err != nil {
+			return err
+		}
+		update := *crdConfig
+		update.ObjectMeta.ResourceVersion = live.ObjectMeta.ResourceVersion
+		body, err := json.Marshal(&update)
+		if err != nil {
+			return err
+		}
+		crd, err = c.decode(c.restClient.Put().
+			Resource("customresourcedefinitions").
+			Name(crdConfig.ObjectMeta.Name).
+			Body(body).
+			DoRaw())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.waitCRDReady(crdConfig.ObjectMeta.Name); err != nil {
+		return nil, err
+	}
+	return crd, nil
+}
+
+func (c *crds) Get(crdName string) (*CustomResourceDefinition, error) {
+	return c.get(crdName)
+}
+
+func (c *crds) get(crdName string) (*CustomResourceDefinition, error) {
+	return c.decode(c.restClient.Get().
+		Resource("customresourcedefinitions").
+		Name(crdName).
+		DoRaw())
+}
+
+func (c *crds) decode(data []byte, err error) (*CustomResourceDefinition, error) {
+	if err != nil {
+		return nil, err
+	}
+	crd := &CustomResourceDefinition{}
+	if err := json.Unmarshal(data, crd); err != nil {
+		return nil, err
+	}
+	return crd, nil
+}
+
 func (c *crds) Delete(crdName string, options *metav1.DeleteOptions) error {
 	return c.client.Delete(crdName, options)
 }
 
+func (c *crds) WaitEstablished(crdName string) error {
+	return c.waitCRDReady(crdName)
+}
+
 func (c *crds) waitCRDReady(crdName string) error {
 	err := wait.Poll(5*time.Second, 30*time.Second, func() (bool, error) {
 		crd, err := c.client.Get(crdName, metav1.GetOptions{})
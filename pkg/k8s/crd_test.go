@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+// newFakeCRDServer serves live as an existing established crd, and records the updates of it.
+func newFakeCRDServer(live *CustomResourceDefinition, updates *[]*CustomResourceDefinition) *httptest.Server {
+	var lock sync.Mutex
+	live.Status.Conditions = []apiextensionsv1beta1.CustomResourceDefinitionCondition{
+		{Type: apiextensionsv1beta1.Established, Status: apiextensionsv1beta1.ConditionTrue},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(&metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonAlreadyExists,
+				Code:     http.StatusConflict,
+			})
+		case http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			update := &CustomResourceDefinition{}
+			if err := json.Unmarshal(body, update); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			*updates = append(*updates, update)
+			live.Spec = update.Spec
+			json.NewEncoder(w).Encode(live)
+		default:
+			json.NewEncoder(w).Encode(live)
+		}
+	}))
+}
+
+func TestCreateExistingCRD(t *testing.T) {
+	config := &CRD{
+		Name:    "tests.demo.io",
+		Kind:    "Test",
+		Plural:  "tests",
+		Group:   "demo.io",
+		Version: "v1",
+		Subresources: &CustomResourceSubresources{
+			Status: &CustomResourceSubresourceStatus{},
+		},
+		Obj: &v1.WebServerCluster{},
+	}
+	desired := MakeCRDConfig(NewCRDData(config))
+
+	outdated := MakeCRDConfig(NewCRDData(config))
+	outdated.Spec.Validation = nil
+	outdated.Spec.Subresources = nil
+
+	tests := []struct {
+		name    string
+		live    *CustomResourceDefinition
+		updated bool
+	}{
+		{name: "up to date", live: MakeCRDConfig(NewCRDData(config)), updated: false},
+		{name: "outdated", live: outdated, updated: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var updates []*CustomResourceDefinition
+			server := newFakeCRDServer(test.live, &updates)
+			defer server.Close()
+			clientset, err := apiextensionsclient.NewForConfig(&rest.Config{Host: server.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			crd, err := NewCRD(clientset).Create(desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated := len(updates) > 0; updated != test.updated {
+				t.Fatalf("expect updated %v, got %d updates", test.updated, len(updates))
+			}
+			if !jsonEqual(crd.Spec.Validation, desired.Spec.Validation) ||
+				!jsonEqual(crd.Spec.Subresources, desired.Spec.Subresources) {
+				t.Fatalf("expect crd spec %+v, got %+v", desired.Spec, crd.Spec)
+			}
+		})
+	}
+}
@@ -2,33 +2,38 @@ package k8s
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/typed/extensions/v1beta1"
 	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 )
 
 type DeploymentData struct {
-	Name string
+	Name      string
+	Namespace string
+	Labels    map[string]string
 
 	Spec extensionsv1beta1.DeploymentSpec
 }
 
+// DeploymentInterface operates deployments in any namespace, the namespace is
+// taken from the object or passed to each call, metav1.NamespaceAll lists all.
 type DeploymentInterface interface {
 	MakeConfig(*DeploymentData) *extensionsv1beta1.Deployment
 	Create(*extensionsv1beta1.Deployment) (*extensionsv1beta1.Deployment, error)
-	Delete(string, *metav1.DeleteOptions) error
+	Delete(string, string, *metav1.DeleteOptions) error
 	Update(*extensionsv1beta1.Deployment) (*extensionsv1beta1.Deployment, error)
+	Get(string, string) (*extensionsv1beta1.Deployment, error)
+	List(string, metav1.ListOptions) (*extensionsv1beta1.DeploymentList, error)
+	Patch(string, string, types.PatchType, []byte) (*extensionsv1beta1.Deployment, error)
 }
 
 type deployments struct {
-	client    v1beta1.DeploymentInterface
-	namespace string
+	kclient *kubernetes.Clientset
 }
 
-func NewDeployment(kclient *kubernetes.Clientset, namespace string) DeploymentInterface {
+func NewDeployment(kclient *kubernetes.Clientset) DeploymentInterface {
 	return &deployments{
-		client:    kclient.ExtensionsV1beta1().Deployments(namespace),
-		namespace: namespace,
+		kclient: kclient,
 	}
 }
 
@@ -36,20 +41,33 @@ func (d *deployments) MakeConfig(data *DeploymentData) *extensionsv1beta1.Deploy
 	return &extensionsv1beta1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      data.Name,
-			Namespace: d.namespace,
+			Namespace: data.Namespace,
+			Labels:    data.Labels,
 		},
 		Spec: data.Spec,
 	}
 }
 
 func (d *deployments) Create(deploy *extensionsv1beta1.Deployment) (*extensionsv1beta1.Deployment, error) {
-	return d.client.Create(deploy)
+	return d.kclient.ExtensionsV1beta1().Deployments(deploy.Namespace).Create(deploy)
 }
 
-func (d *deployments) Delete(deployName string, options *metav1.DeleteOptions) error {
-	return d.client.Delete(deployName, options)
+func (d *deployments) Delete(namespace, deployName string, options *metav1.DeleteOptions) error {
+	return d.kclient.ExtensionsV1beta1().Deployments(namespace).Delete(deployName, options)
 }
 
 func (d *deployments) Update(deploy *extensionsv1beta1.Deployment) (*extensionsv1beta1.Deployment, error) {
-	return d.client.Update(deploy)
-}
\ No newline at end of file
+	return d.kclient.ExtensionsV1beta1().Deployments(deploy.Namespace).Update(deploy)
+}
+
+func (d *deployments) Get(namespace, deployName string) (*extensionsv1beta1.Deployment, error) {
+	return d.kclient.ExtensionsV1beta1().Deployments(namespace).Get(deployName, metav1.GetOptions{})
+}
+
+func (d *deployments) List(namespace string, options metav1.ListOptions) (*extensionsv1beta1.DeploymentList, error) {
+	return d.kclient.ExtensionsV1beta1().Deployments(namespace).List(options)
+}
+
+func (d *deployments) Patch(namespace, deployName string, pt types.PatchType, data []byte) (*extensionsv1beta1.Deployment, error) {
+	return d.kclient.ExtensionsV1beta1().Deployments(namespace).Patch(deployName, pt, data)
+}
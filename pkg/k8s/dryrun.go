@@ -0,0 +1,163 @@
+package k8s
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+const (
+	PlanCreate = "create"
+	PlanUpdate = "update"
+	PlanPatch  = "patch"
+	PlanDelete = "delete"
+)
+
+// PlannedChange is a write which is intercepted in dry-run mode.
+type PlannedChange struct {
+	Action      string `json:"action"`
+	Kind        string `json:"kind"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	Subresource string `json:"subresource,omitempty"`
+	// written object of create and update
+	Object interface{} `json:"object,omitempty"`
+	// patch of patch
+	Patch json.RawMessage `json:"patch,omitempty"`
+	Time  time.Time       `json:"time"`
+}
+
+func (c *PlannedChange) key() string {
+	return c.Kind + "/" + c.Subresource + "/" + c.Namespace + "/" + c.Name
+}
+
+// Plan collects the latest planned change of each object in dry-run mode. A change is planned
+// again on every reconcile until the live object converges, so stale changes can be told by Time.
+type Plan struct {
+	lock    sync.Mutex
+	changes map[string]*PlannedChange
+
+	logger *log.Entry
+}
+
+func NewPlan() *Plan {
+	return &Plan{
+		changes: map[string]*PlannedChange{},
+		logger:  log.WithField("service", "dry-run"),
+	}
+}
+
+// Record logs change and keeps it as the latest planned change of the object.
+func (p *Plan) Record(change *PlannedChange) {
+	change.Time = time.Now()
+	if change.Patch != nil {
+		p.logger.Infof("Plan to %s %s %s/%s: %s", change.Action, change.Kind, change.Namespace, change.Name,
+			change.Patch)
+	} else {
+		p.logger.Infof("Plan to %s %s %s/%s", change.Action, change.Kind, change.Namespace, change.Name)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.changes[change.key()] = change
+}
+
+// Changes returns the latest planned changes sorted by kind, namespace and name.
+func (p *Plan) Changes() []*PlannedChange {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	keys := make([]string, 0, len(p.changes))
+	for key := range p.changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	changes := make([]*PlannedChange, 0, len(keys))
+	for _, key := range keys {
+		changes = append(changes, p.changes[key])
+	}
+	return changes
+}
+
+type dryRunDeployments struct {
+	DeploymentInterface
+	plan *Plan
+}
+
+// NewDryRunDeployment records the writes of deployI in plan instead of sending them, and returns
+// the objects as if they were written. Reads still go to deployI.
+func NewDryRunDeployment(deployI DeploymentInterface, plan *Plan) DeploymentInterface {
+	return &dryRunDeployments{
+		DeploymentInterface: deployI,
+		plan:                plan,
+	}
+}
+
+func (d *dryRunDeployments) Create(deploy *extensionsv1beta1.Deployment) (*extensionsv1beta1.Deployment, error) {
+	d.plan.Record(&PlannedChange{Action: PlanCreate, Kind: "Deployment", Namespace: deploy.Namespace,
+		Name: deploy.Name, Object: deploy})
+	return deploy, nil
+}
+
+func (d *dryRunDeployments) Delete(namespace, deployName string, options *metav1.DeleteOptions) error {
+	d.plan.Record(&PlannedChange{Action: PlanDelete, Kind: "Deployment", Namespace: namespace, Name: deployName})
+	return nil
+}
+
+func (d *dryRunDeployments) Update(deploy *extensionsv1beta1.Deployment) (*extensionsv1beta1.Deployment, error) {
+	d.plan.Record(&PlannedChange{Action: PlanUpdate, Kind: "Deployment", Namespace: deploy.Namespace,
+		Name: deploy.Name, Object: deploy})
+	return deploy, nil
+}
+
+// Patch returns the live deployment, since the patch is not applied.
+func (d *dryRunDeployments) Patch(namespace, deployName string, pt types.PatchType,
+	data []byte) (*extensionsv1beta1.Deployment, error) {
+	d.plan.Record(&PlannedChange{Action: PlanPatch, Kind: "Deployment", Namespace: namespace, Name: deployName,
+		Patch: json.RawMessage(data)})
+	return d.DeploymentInterface.Get(namespace, deployName)
+}
+
+type dryRunServices struct {
+	ServiceInterface
+	plan *Plan
+}
+
+// NewDryRunService records the writes of svcI in plan instead of sending them, and returns
+// the objects as if they were written. Reads still go to svcI.
+func NewDryRunService(svcI ServiceInterface, plan *Plan) ServiceInterface {
+	return &dryRunServices{
+		ServiceInterface: svcI,
+		plan:             plan,
+	}
+}
+
+func (s *dryRunServices) Create(svcConfig *apiv1.Service) (*apiv1.Service, error) {
+	s.plan.Record(&PlannedChange{Action: PlanCreate, Kind: "Service", Namespace: svcConfig.Namespace,
+		Name: svcConfig.Name, Object: svcConfig})
+	return svcConfig, nil
+}
+
+func (s *dryRunServices) Delete(namespace, svcName string, options *metav1.DeleteOptions) error {
+	s.plan.Record(&PlannedChange{Action: PlanDelete, Kind: "Service", Namespace: namespace, Name: svcName})
+	return nil
+}
+
+func (s *dryRunServices) Update(svcConfig *apiv1.Service) (*apiv1.Service, error) {
+	s.plan.Record(&PlannedChange{Action: PlanUpdate, Kind: "Service", Namespace: svcConfig.Namespace,
+		Name: svcConfig.Name, Object: svcConfig})
+	return svcConfig, nil
+}
+
+// Patch returns the live service, since the patch is not applied.
+func (s *dryRunServices) Patch(namespace, svcName string, pt types.PatchType, data []byte) (*apiv1.Service, error) {
+	s.plan.Record(&PlannedChange{Action: PlanPatch, Kind: "Service", Namespace: namespace, Name: svcName,
+		Patch: json.RawMessage(data)})
+	return s.ServiceInterface.Get(namespace, svcName)
+}
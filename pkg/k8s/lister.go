@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// OwnerUIDIndex indexes objects by UIDs of their owners.
+const OwnerUIDIndex = "ownerUID"
+
+func OwnerUIDIndexFunc(obj interface{}) ([]string, error) {
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	uids := []string{}
+	for _, owner := range objMeta.GetOwnerReferences() {
+		uids = append(uids, string(owner.UID))
+	}
+	return uids, nil
+}
+
+// DeploymentLister reads deployments from an informer indexer with OwnerUIDIndex.
+// Returned deployments are copies, which can be modified by callers.
+type DeploymentLister struct {
+	indexer cache.Indexer
+}
+
+func NewDeploymentLister(indexer cache.Indexer) *DeploymentLister {
+	return &DeploymentLister{indexer: indexer}
+}
+
+// Get returns the deployment, or a NotFound error if it is not in the indexer.
+func (l *DeploymentLister) Get(namespace, name string) (*extensionsv1beta1.Deployment, error) {
+	obj, exists, err := l.indexer.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: "extensions", Resource: "deployments"}, name)
+	}
+	return copyDeployment(obj)
+}
+
+func (l *DeploymentLister) ListByOwnerUID(uid types.UID) ([]*extensionsv1beta1.Deployment, error) {
+	objs, err := l.indexer.ByIndex(OwnerUIDIndex, string(uid))
+	if err != nil {
+		return nil, err
+	}
+	deploys := make([]*extensionsv1beta1.Deployment, 0, len(objs))
+	for _, obj := range objs {
+		deploy, err := copyDeployment(obj)
+		if err != nil {
+			return nil, err
+		}
+		deploys = append(deploys, deploy)
+	}
+	return deploys, nil
+}
+
+func copyDeployment(obj interface{}) (*extensionsv1beta1.Deployment, error) {
+	copyObj, err := scheme.Scheme.DeepCopy(obj)
+	if err != nil {
+		return nil, err
+	}
+	return copyObj.(*extensionsv1beta1.Deployment), nil
+}
+
+// ServiceLister reads services from an informer indexer with OwnerUIDIndex.
+// Returned services are copies, which can be modified by callers.
+type ServiceLister struct {
+	indexer cache.Indexer
+}
+
+func NewServiceLister(indexer cache.Indexer) *ServiceLister {
+	return &ServiceLister{indexer: indexer}
+}
+
+// Get returns the service, or a NotFound error if it is not in the indexer.
+func (l *ServiceLister) Get(namespace, name string) (*apiv1.Service, error) {
+	obj, exists, err := l.indexer.GetByKey(namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "services"}, name)
+	}
+	return copyService(obj)
+}
+
+func (l *ServiceLister) ListByOwnerUID(uid types.UID) ([]*apiv1.Service, error) {
+	objs, err := l.indexer.ByIndex(OwnerUIDIndex, string(uid))
+	if err != nil {
+		return nil, err
+	}
+	svcs := make([]*apiv1.Service, 0, len(objs))
+	for _, obj := range objs {
+		svc, err := copyService(obj)
+		if err != nil {
+			return nil, err
+		}
+		svcs = append(svcs, svc)
+	}
+	return svcs, nil
+}
+
+func copyService(obj interface{}) (*apiv1.Service, error) {
+	copyObj, err := scheme.Scheme.DeepCopy(obj)
+	if err != nil {
+		return nil, err
+	}
+	return copyObj.(*apiv1.Service), nil
+}
@@ -0,0 +1,177 @@
+package k8s
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The vendored apiextensions types predate CRD validation,
+// so the OpenAPI v3 schema is described with the local types below.
+type CustomResourceValidation struct {
+	OpenAPIV3Schema *JSONSchemaProps `json:"openAPIV3Schema,omitempty"`
+}
+
+type JSONSchemaProps struct {
+	Type                 string                     `json:"type,omitempty"`
+	Format               string                     `json:"format,omitempty"`
+	Description          string                     `json:"description,omitempty"`
+	Pattern              string                     `json:"pattern,omitempty"`
+	Minimum              *float64                   `json:"minimum,omitempty"`
+	Maximum              *float64                   `json:"maximum,omitempty"`
+	MinLength            *int64                     `json:"minLength,omitempty"`
+	MaxLength            *int64                     `json:"maxLength,omitempty"`
+	MinItems             *int64                     `json:"minItems,omitempty"`
+	MaxItems             *int64                     `json:"maxItems,omitempty"`
+	Enum                 []interface{}              `json:"enum,omitempty"`
+	Required             []string                   `json:"required,omitempty"`
+	Items                *JSONSchemaProps           `json:"items,omitempty"`
+	Properties           map[string]JSONSchemaProps `json:"properties,omitempty"`
+	AdditionalProperties *JSONSchemaProps           `json:"additionalProperties,omitempty"`
+}
+
+var timeType = reflect.TypeOf(metav1.Time{})
+
+// NewCRDValidation builds the validation of a CRD from the Spec field of its Go type.
+func NewCRDValidation(obj interface{}) *CustomResourceValidation {
+	t := reflect.TypeOf(obj)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	specField, ok := t.FieldByName("Spec")
+	if !ok {
+		return nil
+	}
+
+	return &CustomResourceValidation{
+		OpenAPIV3Schema: &JSONSchemaProps{
+			Type: "object",
+			Properties: map[string]JSONSchemaProps{
+				"spec": *NewSchema(specField.Type),
+			},
+			Required: []string{"spec"},
+		},
+	}
+}
+
+// NewSchema generates the OpenAPI v3 schema of a Go type. Struct fields are named
+// by their json tags and constrained by their validate tags, which is a comma
+// separated list of: required, minimum=N, maximum=N, minLength=N, maxLength=N,
+// minItems=N, maxItems=N, pattern=REGEXP, enum=A|B|C.
+// Patterns can't contain commas.
+func NewSchema(t reflect.Type) *JSONSchemaProps {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &JSONSchemaProps{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchemaProps{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchemaProps{Type: "boolean"}
+	case reflect.Int32, reflect.Uint32, reflect.Int16, reflect.Uint16, reflect.Int8, reflect.Uint8:
+		return &JSONSchemaProps{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &JSONSchemaProps{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchemaProps{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchemaProps{Type: "array", Items: NewSchema(t.Elem())}
+	case reflect.Map:
+		return &JSONSchemaProps{Type: "object", AdditionalProperties: NewSchema(t.Elem())}
+	case reflect.Struct:
+		schema := &JSONSchemaProps{Type: "object", Properties: map[string]JSONSchemaProps{}}
+		addStructProperties(schema, t)
+		return schema
+	}
+	return &JSONSchemaProps{}
+}
+
+func addStructProperties(schema *JSONSchemaProps, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		if name == "" && field.Anonymous {
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			addStructProperties(schema, fieldType)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := NewSchema(field.Type)
+		if applyValidateTag(prop, field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = *prop
+	}
+}
+
+// applyValidateTag sets the constraints of the tag on the schema, and
+// returns whether the field is required.
+func applyValidateTag(schema *JSONSchemaProps, tag string) bool {
+	required := false
+	if tag == "" {
+		return required
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		kv := strings.SplitN(rule, "=", 2)
+		key := kv[0]
+		value := ""
+		if len(kv) == 2 {
+			value = kv[1]
+		}
+
+		switch key {
+		case "required":
+			required = true
+		case "minimum":
+			schema.Minimum = parseFloat(value)
+		case "maximum":
+			schema.Maximum = parseFloat(value)
+		case "minLength":
+			schema.MinLength = parseInt(value)
+		case "maxLength":
+			schema.MaxLength = parseInt(value)
+		case "minItems":
+			schema.MinItems = parseInt(value)
+		case "maxItems":
+			schema.MaxItems = parseInt(value)
+		case "pattern":
+			schema.Pattern = value
+		case "enum":
+			for _, item := range strings.Split(value, "|") {
+				schema.Enum = append(schema.Enum, item)
+			}
+		}
+	}
+	return required
+}
+
+func parseFloat(value string) *float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+func parseInt(value string) *int64 {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &i
+}
@@ -0,0 +1,134 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestApplyValidateTag(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      string
+		schema   *JSONSchemaProps
+		required bool
+	}{
+		{name: "empty", tag: "", schema: &JSONSchemaProps{}},
+		{name: "required", tag: "required", schema: &JSONSchemaProps{}, required: true},
+		{
+			name:   "minimum and maximum",
+			tag:    "minimum=1,maximum=65535.5",
+			schema: &JSONSchemaProps{Minimum: float64Ptr(1), Maximum: float64Ptr(65535.5)},
+		},
+		{
+			name: "lengths and items",
+			tag:  "minLength=1,maxLength=15,minItems=2,maxItems=3",
+			schema: &JSONSchemaProps{MinLength: int64Ptr(1), MaxLength: int64Ptr(15),
+				MinItems: int64Ptr(2), MaxItems: int64Ptr(3)},
+		},
+		{name: "invalid number", tag: "minimum=a,maxLength=1.5", schema: &JSONSchemaProps{}},
+		{
+			name:   "pattern containing equal sign",
+			tag:    "pattern=^[a-z]+=[0-9]+$",
+			schema: &JSONSchemaProps{Pattern: "^[a-z]+=[0-9]+$"},
+		},
+		{
+			name:   "enum",
+			tag:    "enum=TCP|UDP",
+			schema: &JSONSchemaProps{Enum: []interface{}{"TCP", "UDP"}},
+		},
+		{
+			name:   "numeric enum as strings",
+			tag:    "enum=1|2",
+			schema: &JSONSchemaProps{Enum: []interface{}{"1", "2"}},
+		},
+		{
+			name:     "combined",
+			tag:      "required,minimum=0,enum=Delete|Orphan",
+			schema:   &JSONSchemaProps{Minimum: float64Ptr(0), Enum: []interface{}{"Delete", "Orphan"}},
+			required: true,
+		},
+		{name: "unknown rule", tag: "unique", schema: &JSONSchemaProps{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema := &JSONSchemaProps{}
+			if required := applyValidateTag(schema, test.tag); required != test.required {
+				t.Fatalf("expect required %v, got %v", test.required, required)
+			}
+			if !reflect.DeepEqual(schema, test.schema) {
+				t.Fatalf("expect schema %+v, got %+v", test.schema, schema)
+			}
+		})
+	}
+}
+
+type schemaTestEmbedded struct {
+	Embedded string `json:"embedded"`
+}
+
+type schemaTestStruct struct {
+	schemaTestEmbedded `json:",inline"`
+
+	Name     string            `json:"name" validate:"required,maxLength=15,pattern=^[a-z]+$"`
+	Port     int32             `json:"port,omitempty" validate:"minimum=1,maximum=65535"`
+	Replicas *int32            `json:"replicas,omitempty" validate:"enum=1|3"`
+	Protocol string            `json:"protocol,omitempty" validate:"required,enum=TCP|UDP"`
+	Ports    []int64           `json:"ports,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Time     *metav1.Time      `json:"time,omitempty"`
+	Skipped  string            `json:"-"`
+	private  string
+}
+
+func TestNewSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		obj    interface{}
+		schema *JSONSchemaProps
+	}{
+		{name: "string", obj: "", schema: &JSONSchemaProps{Type: "string"}},
+		{name: "bool", obj: false, schema: &JSONSchemaProps{Type: "boolean"}},
+		{name: "int32 pointer", obj: new(int32), schema: &JSONSchemaProps{Type: "integer", Format: "int32"}},
+		{name: "int", obj: 0, schema: &JSONSchemaProps{Type: "integer", Format: "int64"}},
+		{name: "float", obj: 0.5, schema: &JSONSchemaProps{Type: "number"}},
+		{
+			name: "struct",
+			obj:  schemaTestStruct{},
+			schema: &JSONSchemaProps{
+				Type: "object",
+				Properties: map[string]JSONSchemaProps{
+					"embedded": {Type: "string"},
+					"name":     {Type: "string", MaxLength: int64Ptr(15), Pattern: "^[a-z]+$"},
+					"port": {Type: "integer", Format: "int32", Minimum: float64Ptr(1),
+						Maximum: float64Ptr(65535)},
+					"replicas": {Type: "integer", Format: "int32", Enum: []interface{}{"1", "3"}},
+					"protocol": {Type: "string", Enum: []interface{}{"TCP", "UDP"}},
+					"ports":    {Type: "array", Items: &JSONSchemaProps{Type: "integer", Format: "int64"}},
+					"labels":   {Type: "object", AdditionalProperties: &JSONSchemaProps{Type: "string"}},
+					"time":     {Type: "string", Format: "date-time"},
+				},
+				Required: []string{"name", "protocol"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema := NewSchema(reflect.TypeOf(test.obj))
+			if !reflect.DeepEqual(schema, test.schema) {
+				t.Fatalf("expect schema %+v, got %+v", test.schema, schema)
+			}
+		})
+	}
+}
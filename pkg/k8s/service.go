@@ -2,59 +2,74 @@ package k8s
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/typed/core/v1"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 )
 
 type ServiceData struct {
-	Name string
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
 
 	Spec apiv1.ServiceSpec
 }
 
+// ServiceInterface operates services in any namespace, the namespace is taken
+// from the object or passed to each call, metav1.NamespaceAll lists all.
 type ServiceInterface interface {
 	MakeConfig(*ServiceData) *apiv1.Service
 	Create(*apiv1.Service) (*apiv1.Service, error)
-	Delete(string, *metav1.DeleteOptions) error
+	Delete(string, string, *metav1.DeleteOptions) error
 	Update(*apiv1.Service) (*apiv1.Service, error)
-	Get(string) (*apiv1.Service, error)
+	Get(string, string) (*apiv1.Service, error)
+	List(string, metav1.ListOptions) (*apiv1.ServiceList, error)
+	Patch(string, string, types.PatchType, []byte) (*apiv1.Service, error)
 }
 
 type services struct {
-	client    v1.ServiceInterface
-	namespace string
+	kclient *kubernetes.Clientset
 }
 
-func NewService(kclient *kubernetes.Clientset, namespace string) ServiceInterface {
+func NewService(kclient *kubernetes.Clientset) ServiceInterface {
 	return &services{
-		client:    kclient.CoreV1().Services(namespace),
-		namespace: namespace,
+		kclient: kclient,
 	}
 }
 
 func (s *services) MakeConfig(data *ServiceData) *apiv1.Service {
 	return &apiv1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: data.Name,
-			Namespace: s.namespace,
+			Name:        data.Name,
+			Namespace:   data.Namespace,
+			Labels:      data.Labels,
+			Annotations: data.Annotations,
 		},
 		Spec: data.Spec,
 	}
 }
 
 func (s *services) Create(svcConfig *apiv1.Service) (*apiv1.Service, error) {
-	return s.client.Create(svcConfig)
+	return s.kclient.CoreV1().Services(svcConfig.Namespace).Create(svcConfig)
 }
 
-func (s *services) Delete(svcName string, options *metav1.DeleteOptions) error {
-	return s.client.Delete(svcName, options)
+func (s *services) Delete(namespace, svcName string, options *metav1.DeleteOptions) error {
+	return s.kclient.CoreV1().Services(namespace).Delete(svcName, options)
 }
 
 func (s *services) Update(svcConfig *apiv1.Service) (*apiv1.Service, error) {
-	return s.client.Update(svcConfig)
+	return s.kclient.CoreV1().Services(svcConfig.Namespace).Update(svcConfig)
 }
 
-func (s *services) Get(svcName string) (*apiv1.Service, error) {
-	return s.client.Get(svcName, metav1.GetOptions{})
+func (s *services) Get(namespace, svcName string) (*apiv1.Service, error) {
+	return s.kclient.CoreV1().Services(namespace).Get(svcName, metav1.GetOptions{})
+}
+
+func (s *services) List(namespace string, options metav1.ListOptions) (*apiv1.ServiceList, error) {
+	return s.kclient.CoreV1().Services(namespace).List(options)
+}
+
+func (s *services) Patch(namespace, svcName string, pt types.PatchType, data []byte) (*apiv1.Service, error) {
+	return s.kclient.CoreV1().Services(namespace).Patch(svcName, pt, data)
 }
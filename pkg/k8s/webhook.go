@@ -0,0 +1,159 @@
+package k8s
+
+import (
+	"encoding/json"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+)
+
+// The vendored client-go only knows admissionregistration.k8s.io/v1alpha1,
+// so admission webhook configurations are described with the local types below.
+type ValidatingWebhookConfiguration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+}
+
+type MutatingWebhookConfiguration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+}
+
+type FailurePolicyType string
+
+const (
+	WebhookFailurePolicyIgnore FailurePolicyType = "Ignore"
+	WebhookFailurePolicyFail   FailurePolicyType = "Fail"
+)
+
+type Webhook struct {
+	Name              string                `json:"name"`
+	ClientConfig      WebhookClientConfig   `json:"clientConfig"`
+	Rules             []RuleWithOperations  `json:"rules,omitempty"`
+	FailurePolicy     *FailurePolicyType    `json:"failurePolicy,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+type WebhookClientConfig struct {
+	URL      *string           `json:"url,omitempty"`
+	Service  *ServiceReference `json:"service,omitempty"`
+	CABundle []byte            `json:"caBundle,omitempty"`
+}
+
+type ServiceReference struct {
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Path      *string `json:"path,omitempty"`
+}
+
+type OperationType string
+
+const (
+	OperationCreate OperationType = "CREATE"
+	OperationUpdate OperationType = "UPDATE"
+)
+
+type RuleWithOperations struct {
+	Operations  []OperationType `json:"operations,omitempty"`
+	APIGroups   []string        `json:"apiGroups,omitempty"`
+	APIVersions []string        `json:"apiVersions,omitempty"`
+	Resources   []string        `json:"resources,omitempty"`
+}
+
+type WebhookConfigurationInterface interface {
+	ApplyValidating(*ValidatingWebhookConfiguration) error
+	ApplyMutating(*MutatingWebhookConfiguration) error
+	DeleteValidating(string) error
+	DeleteMutating(string) error
+}
+
+const (
+	validatingWebhookConfigurations = "validatingwebhookconfigurations"
+	mutatingWebhookConfigurations   = "mutatingwebhookconfigurations"
+)
+
+var admissionRegistrationGroupVersion = schema.GroupVersion{
+	Group:   "admissionregistration.k8s.io",
+	Version: "v1beta1",
+}
+
+type webhookConfigurations struct {
+	client rest.Interface
+}
+
+func NewWebhookConfiguration(kubeConfig *rest.Config) (WebhookConfigurationInterface, error) {
+	cfg := *kubeConfig
+	cfg.GroupVersion = &admissionRegistrationGroupVersion
+	cfg.APIPath = "/apis"
+	cfg.ContentType = runtime.ContentTypeJSON
+	cfg.NegotiatedSerializer = serializer.DirectCodecFactory{
+		CodecFactory: serializer.NewCodecFactory(runtime.NewScheme()),
+	}
+
+	client, err := rest.RESTClientFor(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &webhookConfigurations{client: client}, nil
+}
+
+func (w *webhookConfigurations) ApplyValidating(config *ValidatingWebhookConfiguration) error {
+	config.TypeMeta = metav1.TypeMeta{
+		Kind:       "ValidatingWebhookConfiguration",
+		APIVersion: admissionRegistrationGroupVersion.String(),
+	}
+	return w.apply(validatingWebhookConfigurations, &config.ObjectMeta, config)
+}
+
+func (w *webhookConfigurations) ApplyMutating(config *MutatingWebhookConfiguration) error {
+	config.TypeMeta = metav1.TypeMeta{
+		Kind:       "MutatingWebhookConfiguration",
+		APIVersion: admissionRegistrationGroupVersion.String(),
+	}
+	return w.apply(mutatingWebhookConfigurations, &config.ObjectMeta, config)
+}
+
+func (w *webhookConfigurations) DeleteValidating(name string) error {
+	return w.client.Delete().Resource(validatingWebhookConfigurations).Name(name).Do().Error()
+}
+
+func (w *webhookConfigurations) DeleteMutating(name string) error {
+	return w.client.Delete().Resource(mutatingWebhookConfigurations).Name(name).Do().Error()
+}
+
+// apply creates the configuration, or replaces the existing one of the same name.
+func (w *webhookConfigurations) apply(resource string, meta *metav1.ObjectMeta, config interface{}) error {
+	data, err := w.client.Get().Resource(resource).Name(meta.Name).DoRaw()
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	if apierrors.IsNotFound(err) {
+		body, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		return w.client.Post().Resource(resource).Body(body).Do().Error()
+	}
+
+	current := &metav1.ObjectMeta{}
+	if err := json.Unmarshal(data, &struct {
+		Metadata *metav1.ObjectMeta `json:"metadata"`
+	}{current}); err != nil {
+		return err
+	}
+	meta.ResourceVersion = current.ResourceVersion
+	body, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return w.client.Put().Resource(resource).Name(meta.Name).Body(body).Do().Error()
+}
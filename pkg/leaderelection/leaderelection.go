@@ -0,0 +1,267 @@
+// Package leaderelection implements lease-based leader election among operator replicas,
+// following the algorithm of client-go leaderelection which is not in the vendored client-go.
+//
+// The leader renews the record in the lock object every RetryPeriod. Other candidates take
+// over if the record is not renewed within LeaseDuration, and the leader steps down if it
+// fails to renew within RenewDeadline.
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const JitterFactor = 1.2
+
+type LeaderCallbacks struct {
+	// OnStartedLeading is called in a new goroutine when the candidate becomes leader,
+	// ctx is canceled when the leadership is lost
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called when Run returns
+	OnStoppedLeading func()
+	// OnNewLeader is called when the observed leader changes, optional
+	OnNewLeader func(identity string)
+}
+
+type LeaderElectionConfig struct {
+	Lock ResourceLock
+
+	// duration that candidates wait before taking over an unrenewed leadership
+	LeaseDuration time.Duration
+	// duration that the leader retries renewing before giving up the leadership
+	RenewDeadline time.Duration
+	// interval of acquiring and renewing
+	RetryPeriod time.Duration
+
+	Callbacks LeaderCallbacks
+
+	// real clock if nil, tests can use a fake clock
+	Clock clock.Clock
+}
+
+type LeaderElector struct {
+	config *LeaderElectionConfig
+	clock  clock.Clock
+
+	lock sync.Mutex
+	// record and the local time it is observed at, the remote time is not trusted
+	observedRecord LeaderElectionRecord
+	observedTime   time.Time
+	reportedLeader string
+
+	// serializes writes of the record, so that Run does not renew the leadership once it is released
+	writeLock sync.Mutex
+	released  bool
+
+	logger *log.Entry
+}
+
+func NewLeaderElector(config *LeaderElectionConfig) (*LeaderElector, error) {
+	if config.LeaseDuration <= config.RenewDeadline {
+		return nil, errors.New("leaseDuration must be greater than renewDeadline")
+	}
+	if config.RenewDeadline <= time.Duration(JitterFactor*float64(config.RetryPeriod)) {
+		return nil, errors.New("renewDeadline must be greater than retryPeriod*JitterFactor")
+	}
+	if config.Lock == nil {
+		return nil, errors.New("Lock must not be nil")
+	}
+	if config.Callbacks.OnStartedLeading == nil || config.Callbacks.OnStoppedLeading == nil {
+		return nil, errors.New("OnStartedLeading and OnStoppedLeading callbacks must not be nil")
+	}
+
+	c := config.Clock
+	if c == nil {
+		c = clock.RealClock{}
+	}
+	return &LeaderElector{
+		config: config,
+		clock:  c,
+		logger: log.WithField("service", "leader-election"),
+	}, nil
+}
+
+// Run acquires the leadership and renews it until it is lost or ctx is done.
+func (le *LeaderElector) Run(ctx context.Context) {
+	defer le.config.Callbacks.OnStoppedLeading()
+
+	if !le.acquire(ctx) {
+		return
+	}
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go le.config.Callbacks.OnStartedLeading(leaderCtx)
+	le.renew(leaderCtx)
+}
+
+// IsLeader returns whether the last observed leader is this candidate.
+func (le *LeaderElector) IsLeader() bool {
+	le.lock.Lock()
+	defer le.lock.Unlock()
+	return le.observedRecord.HolderIdentity == le.config.Lock.Identity()
+}
+
+// GetLeader returns the identity of the last observed leader.
+func (le *LeaderElector) GetLeader() string {
+	le.lock.Lock()
+	defer le.lock.Unlock()
+	return le.observedRecord.HolderIdentity
+}
+
+// Release gives up the leadership if this candidate is the leader, so that other candidates
+// take over without waiting for LeaseDuration. It should be called after ctx of Run is done,
+// and returns whether the leadership is released.
+func (le *LeaderElector) Release() bool {
+	le.writeLock.Lock()
+	defer le.writeLock.Unlock()
+	if !le.IsLeader() {
+		return false
+	}
+	now := metav1.NewTime(le.clock.Now())
+	record := LeaderElectionRecord{
+		LeaseDurationSeconds: 1,
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+	le.lock.Lock()
+	record.LeaderTransitions = le.observedRecord.LeaderTransitions
+	le.lock.Unlock()
+
+	if err := le.config.Lock.Update(record); err != nil {
+		le.logger.Errorf("Failed to release leader lease %s: %v", le.config.Lock.Describe(), err)
+		return false
+	}
+	le.setObservedRecord(record, le.clock.Now())
+	le.released = true
+	return true
+}
+
+// acquire loops until the leadership is acquired or ctx is done, and returns whether it is acquired.
+func (le *LeaderElector) acquire(ctx context.Context) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	succeeded := false
+	le.logger.Infof("Attempt to acquire leader lease %s", le.config.Lock.Describe())
+	wait.JitterUntil(func() {
+		succeeded = le.tryAcquireOrRenew()
+		le.maybeReportTransition()
+		if !succeeded {
+			return
+		}
+		le.logger.Infof("Successfully acquire leader lease %s", le.config.Lock.Describe())
+		cancel()
+	}, le.config.RetryPeriod, JitterFactor, true, ctx.Done())
+	return succeeded
+}
+
+// renew loops until the leadership is not renewed within RenewDeadline or ctx is done.
+func (le *LeaderElector) renew(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wait.Until(func() {
+		deadline := le.clock.Now().Add(le.config.RenewDeadline)
+		for !le.tryAcquireOrRenew() {
+			if !le.clock.Now().Before(deadline) {
+				le.maybeReportTransition()
+				le.logger.Errorf("Failed to renew leader lease %s within %v", le.config.Lock.Describe(),
+					le.config.RenewDeadline)
+				cancel()
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-le.clock.After(le.config.RetryPeriod):
+			}
+		}
+		le.maybeReportTransition()
+	}, le.config.RetryPeriod, ctx.Done())
+}
+
+// tryAcquireOrRenew creates or updates the record if it is held by this candidate or expired,
+// and returns whether this candidate holds the leadership.
+func (le *LeaderElector) tryAcquireOrRenew() bool {
+	le.writeLock.Lock()
+	defer le.writeLock.Unlock()
+	if le.released {
+		return false
+	}
+
+	now := le.clock.Now()
+	record := LeaderElectionRecord{
+		HolderIdentity:       le.config.Lock.Identity(),
+		LeaseDurationSeconds: int(le.config.LeaseDuration / time.Second),
+		AcquireTime:          metav1.NewTime(now),
+		RenewTime:            metav1.NewTime(now),
+	}
+
+	oldRecord, err := le.config.Lock.Get()
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			le.logger.Errorf("Failed to get leader lease %s: %v", le.config.Lock.Describe(), err)
+			return false
+		}
+		if err := le.config.Lock.Create(record); err != nil {
+			le.logger.Errorf("Failed to create leader lease %s: %v", le.config.Lock.Describe(), err)
+			return false
+		}
+		le.setObservedRecord(record, now)
+		return true
+	}
+
+	le.lock.Lock()
+	if !reflect.DeepEqual(le.observedRecord, *oldRecord) {
+		le.observedRecord = *oldRecord
+		le.observedTime = now
+	}
+	isLeader := le.observedRecord.HolderIdentity == le.config.Lock.Identity()
+	unexpired := le.observedTime.Add(le.config.LeaseDuration).After(now)
+	le.lock.Unlock()
+
+	if len(oldRecord.HolderIdentity) > 0 && unexpired && !isLeader {
+		return false
+	}
+
+	if isLeader {
+		record.AcquireTime = oldRecord.AcquireTime
+		record.LeaderTransitions = oldRecord.LeaderTransitions
+	} else {
+		record.LeaderTransitions = oldRecord.LeaderTransitions + 1
+	}
+	if err := le.config.Lock.Update(record); err != nil {
+		le.logger.Errorf("Failed to update leader lease %s: %v", le.config.Lock.Describe(), err)
+		return false
+	}
+	le.setObservedRecord(record, now)
+	return true
+}
+
+func (le *LeaderElector) setObservedRecord(record LeaderElectionRecord, observedTime time.Time) {
+	le.lock.Lock()
+	defer le.lock.Unlock()
+	le.observedRecord = record
+	le.observedTime = observedTime
+}
+
+func (le *LeaderElector) maybeReportTransition() {
+	leader := le.GetLeader()
+	if leader == le.reportedLeader {
+		return
+	}
+	le.reportedLeader = leader
+	le.logger.Infof("Leader of %s is %s", le.config.Lock.Describe(), leader)
+	if le.config.Callbacks.OnNewLeader != nil {
+		go le.config.Callbacks.OnNewLeader(leader)
+	}
+}
@@ -0,0 +1,275 @@
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/clock"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/rest"
+)
+
+// fakeConfigMaps keeps ConfigMaps in memory, and rejects updates of stale resource versions.
+type fakeConfigMaps struct {
+	// methods not used by ConfigMapLock panic
+	corev1client.ConfigMapInterface
+
+	lock            sync.Mutex
+	namespace       string
+	cms             map[string]*apiv1.ConfigMap
+	resourceVersion int
+}
+
+func newFakeConfigMaps() *fakeConfigMaps {
+	return &fakeConfigMaps{cms: map[string]*apiv1.ConfigMap{}}
+}
+
+func (f *fakeConfigMaps) ConfigMaps(namespace string) corev1client.ConfigMapInterface {
+	return f
+}
+
+func (f *fakeConfigMaps) Get(name string, options metav1.GetOptions) (*apiv1.ConfigMap, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	cm, ok := f.cms[name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+	return copyConfigMap(cm), nil
+}
+
+func (f *fakeConfigMaps) Create(cm *apiv1.ConfigMap) (*apiv1.ConfigMap, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.cms[cm.Name]; ok {
+		return nil, apierrors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, cm.Name)
+	}
+	return f.store(cm), nil
+}
+
+func (f *fakeConfigMaps) Update(cm *apiv1.ConfigMap) (*apiv1.ConfigMap, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	old, ok := f.cms[cm.Name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, cm.Name)
+	}
+	if old.ResourceVersion != cm.ResourceVersion {
+		return nil, apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, cm.Name, nil)
+	}
+	return f.store(cm), nil
+}
+
+func (f *fakeConfigMaps) store(cm *apiv1.ConfigMap) *apiv1.ConfigMap {
+	f.resourceVersion++
+	cm = copyConfigMap(cm)
+	cm.ResourceVersion = strconv.Itoa(f.resourceVersion)
+	f.cms[cm.Name] = cm
+	return copyConfigMap(cm)
+}
+
+func copyConfigMap(cm *apiv1.ConfigMap) *apiv1.ConfigMap {
+	cmCopy := *cm
+	cmCopy.Annotations = map[string]string{}
+	for k, v := range cm.Annotations {
+		cmCopy.Annotations[k] = v
+	}
+	return &cmCopy
+}
+
+// newFakeLeaseServer serves the leases of namespace ns in memory, and rejects updates of stale
+// resource versions.
+func newFakeLeaseServer() *httptest.Server {
+	var lock sync.Mutex
+	leases := map[string]*Lease{}
+	resourceVersion := 0
+	prefix := "/apis/coordination.k8s.io/v1/namespaces/ns/leases"
+
+	store := func(w http.ResponseWriter, r *http.Request, code int) {
+		lease := &Lease{}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, lease); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resourceVersion++
+		lease.ResourceVersion = strconv.Itoa(resourceVersion)
+		leases[lease.Name] = lease
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(lease)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		lease, ok := leases[name]
+
+		switch r.Method {
+		case http.MethodGet:
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(lease)
+		case http.MethodPost:
+			store(w, r, http.StatusCreated)
+		case http.MethodPut:
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			update := &Lease{}
+			if err := json.Unmarshal(body, update); err != nil || update.ResourceVersion != lease.ResourceVersion {
+				http.Error(w, "conflict", http.StatusConflict)
+				return
+			}
+			r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+			store(w, r, http.StatusOK)
+		default:
+			http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func newTestElector(t *testing.T, lock ResourceLock, c clock.Clock) *LeaderElector {
+	le, err := NewLeaderElector(&LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+		Callbacks: LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {},
+			OnStoppedLeading: func() {},
+		},
+		Clock: c,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return le
+}
+
+func TestResourceLocks(t *testing.T) {
+	cms := newFakeConfigMaps()
+	server := newFakeLeaseServer()
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		newLock func(identity string) (ResourceLock, error)
+	}{
+		{
+			name: ConfigMapsResourceLock,
+			newLock: func(identity string) (ResourceLock, error) {
+				return NewResourceLock(ConfigMapsResourceLock, nil, cms,
+					ResourceLockConfig{Identity: identity, Namespace: "ns", Name: "lock"})
+			},
+		},
+		{
+			name: LeasesResourceLock,
+			newLock: func(identity string) (ResourceLock, error) {
+				return NewResourceLock(LeasesResourceLock, &rest.Config{Host: server.URL}, nil,
+					ResourceLockConfig{Identity: identity, Namespace: "ns", Name: "lock"})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lockA, err := test.newLock("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			lockB, err := test.newLock("b")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// whole seconds, as record times are serialized in seconds
+			start := time.Unix(1500000000, 0)
+			c := clock.NewFakeClock(start)
+			a := newTestElector(t, lockA, c)
+			b := newTestElector(t, lockB, c)
+
+			expectRecord := func(holder string, transitions int, renewTime time.Time) *LeaderElectionRecord {
+				record, err := lockA.Get()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if record.HolderIdentity != holder || record.LeaderTransitions != transitions ||
+					!record.RenewTime.Time.Equal(renewTime) {
+					t.Fatalf("expect holder %q with %d transitions renewed at %v, got %+v", holder,
+						transitions, renewTime, record)
+				}
+				return record
+			}
+
+			// acquire
+			if !a.tryAcquireOrRenew() || !a.IsLeader() {
+				t.Fatal("expect a to acquire the leadership")
+			}
+			if b.tryAcquireOrRenew() || b.IsLeader() || b.GetLeader() != "a" {
+				t.Fatal("expect b to observe the leadership of a")
+			}
+			expectRecord("a", 0, start)
+
+			// renew
+			c.Step(5 * time.Second)
+			if !a.tryAcquireOrRenew() {
+				t.Fatal("expect a to renew the leadership")
+			}
+			record := expectRecord("a", 0, c.Now())
+			if !record.AcquireTime.Time.Equal(start) {
+				t.Fatalf("expect acquire time %v kept on renewal, got %v", start, record.AcquireTime)
+			}
+
+			// steal after the lease expires
+			c.Step(10 * time.Second)
+			if b.tryAcquireOrRenew() {
+				t.Fatal("expect b not to acquire the renewed leadership")
+			}
+			c.Step(16 * time.Second)
+			if !b.tryAcquireOrRenew() || !b.IsLeader() {
+				t.Fatal("expect b to acquire the expired leadership")
+			}
+			expectRecord("b", 1, c.Now())
+			if a.tryAcquireOrRenew() || a.IsLeader() {
+				t.Fatal("expect a to lose the leadership")
+			}
+
+			// release
+			c.Step(time.Second)
+			if a.Release() {
+				t.Fatal("expect a not to release the leadership of b")
+			}
+			if !b.Release() || b.IsLeader() {
+				t.Fatal("expect b to release the leadership")
+			}
+			expectRecord("", 1, c.Now())
+			if b.tryAcquireOrRenew() {
+				t.Fatal("expect b not to renew the released leadership")
+			}
+			if !a.tryAcquireOrRenew() || !a.IsLeader() {
+				t.Fatal("expect a to acquire the released leadership")
+			}
+			expectRecord("a", 2, c.Now())
+		})
+	}
+}
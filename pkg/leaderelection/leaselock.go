@@ -0,0 +1,167 @@
+package leaderelection
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+)
+
+// Lease types of coordination.k8s.io/v1 (kubernetes 1.14+), which is not in the vendored client-go.
+
+type Lease struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec LeaseSpec `json:"spec,omitempty"`
+}
+
+type LeaseSpec struct {
+	HolderIdentity       *string           `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds *int32            `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *metav1.MicroTime `json:"acquireTime,omitempty"`
+	RenewTime            *metav1.MicroTime `json:"renewTime,omitempty"`
+	LeaseTransitions     *int32            `json:"leaseTransitions,omitempty"`
+}
+
+var coordinationGroupVersion = schema.GroupVersion{Group: "coordination.k8s.io", Version: "v1"}
+
+// LeaseLock stores the record in the spec of Lease.
+type LeaseLock struct {
+	client rest.Interface
+	config ResourceLockConfig
+
+	// guards lease, which Release writes while Run may still be renewing
+	lock  sync.Mutex
+	lease *Lease
+}
+
+func NewLeaseLock(kubeConfig *rest.Config, config ResourceLockConfig) (*LeaseLock, error) {
+	cfg := *kubeConfig
+	cfg.GroupVersion = &coordinationGroupVersion
+	cfg.APIPath = "/apis"
+	cfg.ContentType = runtime.ContentTypeJSON
+	cfg.NegotiatedSerializer = serializer.DirectCodecFactory{
+		CodecFactory: serializer.NewCodecFactory(runtime.NewScheme()),
+	}
+
+	client, err := rest.RESTClientFor(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &LeaseLock{
+		client: client,
+		config: config,
+	}, nil
+}
+
+func (l *LeaseLock) Get() (*LeaderElectionRecord, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	body, err := l.client.Get().
+		Namespace(l.config.Namespace).
+		Resource("leases").
+		Name(l.config.Name).
+		DoRaw()
+	if err != nil {
+		return nil, err
+	}
+	lease := &Lease{}
+	if err := json.Unmarshal(body, lease); err != nil {
+		return nil, err
+	}
+	l.lease = lease
+	return leaseSpecToRecord(&lease.Spec), nil
+}
+
+func (l *LeaseLock) Create(record LeaderElectionRecord) error {
+	lease := &Lease{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: coordinationGroupVersion.String(),
+			Kind:       "Lease",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      l.config.Name,
+			Namespace: l.config.Namespace,
+		},
+		Spec: recordToLeaseSpec(&record),
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.write(l.client.Post().Namespace(l.config.Namespace).Resource("leases"), lease)
+}
+
+func (l *LeaseLock) Update(record LeaderElectionRecord) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.lease == nil {
+		return errors.New("Lease lock is not initialized, call Get or Create first")
+	}
+	l.lease.Spec = recordToLeaseSpec(&record)
+	return l.write(l.client.Put().Namespace(l.config.Namespace).Resource("leases").Name(l.config.Name), l.lease)
+}
+
+// write sends lease by req and keeps the result, l.lock must be held.
+func (l *LeaseLock) write(req *rest.Request, lease *Lease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	body, err := req.Body(data).DoRaw()
+	if err != nil {
+		return err
+	}
+	result := &Lease{}
+	if err := json.Unmarshal(body, result); err != nil {
+		return err
+	}
+	l.lease = result
+	return nil
+}
+
+func (l *LeaseLock) Identity() string {
+	return l.config.Identity
+}
+
+func (l *LeaseLock) Describe() string {
+	return l.config.Namespace + "/" + l.config.Name
+}
+
+func leaseSpecToRecord(spec *LeaseSpec) *LeaderElectionRecord {
+	record := &LeaderElectionRecord{}
+	if spec.HolderIdentity != nil {
+		record.HolderIdentity = *spec.HolderIdentity
+	}
+	if spec.LeaseDurationSeconds != nil {
+		record.LeaseDurationSeconds = int(*spec.LeaseDurationSeconds)
+	}
+	if spec.LeaseTransitions != nil {
+		record.LeaderTransitions = int(*spec.LeaseTransitions)
+	}
+	if spec.AcquireTime != nil {
+		record.AcquireTime = metav1.NewTime(spec.AcquireTime.Time)
+	}
+	if spec.RenewTime != nil {
+		record.RenewTime = metav1.NewTime(spec.RenewTime.Time)
+	}
+	return record
+}
+
+func recordToLeaseSpec(record *LeaderElectionRecord) LeaseSpec {
+	leaseDurationSeconds := int32(record.LeaseDurationSeconds)
+	leaseTransitions := int32(record.LeaderTransitions)
+	acquireTime := metav1.NewMicroTime(record.AcquireTime.Time)
+	renewTime := metav1.NewMicroTime(record.RenewTime.Time)
+	return LeaseSpec{
+		HolderIdentity:       &record.HolderIdentity,
+		LeaseDurationSeconds: &leaseDurationSeconds,
+		AcquireTime:          &acquireTime,
+		RenewTime:            &renewTime,
+		LeaseTransitions:     &leaseTransitions,
+	}
+}
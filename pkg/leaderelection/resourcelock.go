@@ -0,0 +1,152 @@
+package leaderelection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// annotation of the lock object which holds the leader election record
+	LeaderElectionRecordAnnotationKey = "control-plane.alpha.kubernetes.io/leader"
+
+	ConfigMapsResourceLock = "configmaps"
+	LeasesResourceLock     = "leases"
+)
+
+// LeaderElectionRecord is the record stored in the lock object.
+type LeaderElectionRecord struct {
+	HolderIdentity       string      `json:"holderIdentity"`
+	LeaseDurationSeconds int         `json:"leaseDurationSeconds"`
+	AcquireTime          metav1.Time `json:"acquireTime"`
+	RenewTime            metav1.Time `json:"renewTime"`
+	LeaderTransitions    int         `json:"leaderTransitions"`
+}
+
+// ResourceLockConfig is the identity of the candidate and the lock object.
+type ResourceLockConfig struct {
+	Identity  string
+	Namespace string
+	Name      string
+}
+
+// ResourceLock is the object which leader election candidates compete for.
+type ResourceLock interface {
+	// Get returns the record in the lock object, or a NotFound error if it does not exist
+	Get() (*LeaderElectionRecord, error)
+	Create(LeaderElectionRecord) error
+	// Update updates the record of the lock object got by the last Get or Create
+	Update(LeaderElectionRecord) error
+	// Identity returns the identity of the candidate
+	Identity() string
+	// Describe returns the namespace/name of the lock object
+	Describe() string
+}
+
+// NewResourceLock creates a ResourceLock of lockType, which is ConfigMapsResourceLock or LeasesResourceLock.
+func NewResourceLock(lockType string, kubeConfig *rest.Config, cmClient corev1client.ConfigMapsGetter,
+	config ResourceLockConfig) (ResourceLock, error) {
+	switch lockType {
+	case ConfigMapsResourceLock:
+		return NewConfigMapLock(cmClient, config), nil
+	case LeasesResourceLock:
+		return NewLeaseLock(kubeConfig, config)
+	default:
+		return nil, fmt.Errorf("unknown resource lock type %s", lockType)
+	}
+}
+
+// ConfigMapLock stores the record in an annotation of ConfigMap.
+type ConfigMapLock struct {
+	client corev1client.ConfigMapsGetter
+	config ResourceLockConfig
+
+	// guards cm, which Release writes while Run may still be renewing
+	lock sync.Mutex
+	cm   *apiv1.ConfigMap
+}
+
+// NewConfigMapLock creates a ConfigMapLock, client can be a fake clientset in tests.
+func NewConfigMapLock(client corev1client.ConfigMapsGetter, config ResourceLockConfig) *ConfigMapLock {
+	return &ConfigMapLock{
+		client: client,
+		config: config,
+	}
+}
+
+func (l *ConfigMapLock) Get() (*LeaderElectionRecord, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	cm, err := l.client.ConfigMaps(l.config.Namespace).Get(l.config.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	l.cm = cm
+
+	record := &LeaderElectionRecord{}
+	if recordBytes, ok := cm.Annotations[LeaderElectionRecordAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(recordBytes), record); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+func (l *ConfigMapLock) Create(record LeaderElectionRecord) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	cm, err := l.client.ConfigMaps(l.config.Namespace).Create(&apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      l.config.Name,
+			Namespace: l.config.Namespace,
+			Annotations: map[string]string{
+				LeaderElectionRecordAnnotationKey: string(recordBytes),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	l.cm = cm
+	return nil
+}
+
+func (l *ConfigMapLock) Update(record LeaderElectionRecord) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.cm == nil {
+		return errors.New("ConfigMap lock is not initialized, call Get or Create first")
+	}
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if l.cm.Annotations == nil {
+		l.cm.Annotations = map[string]string{}
+	}
+	l.cm.Annotations[LeaderElectionRecordAnnotationKey] = string(recordBytes)
+	cm, err := l.client.ConfigMaps(l.config.Namespace).Update(l.cm)
+	if err != nil {
+		return err
+	}
+	l.cm = cm
+	return nil
+}
+
+func (l *ConfigMapLock) Identity() string {
+	return l.config.Identity
+}
+
+func (l *ConfigMapLock) Describe() string {
+	return l.config.Namespace + "/" + l.config.Name
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net/url"
+	"time"
+
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+var (
+	requestLatency = NewHistogramVec("rest_client_request_latency_seconds",
+		"Request latency in seconds of kubernetes clients, broken down by verb and host.", nil, "verb", "host")
+	requestResult = NewCounterVec("rest_client_requests_total",
+		"Number of kubernetes client requests, partitioned by status code, method and host.",
+		"code", "method", "host")
+)
+
+func init() {
+	MustRegister(requestLatency, requestResult)
+	clientmetrics.Register(latencyAdapter{}, resultAdapter{})
+}
+
+// latencyAdapter implements clientmetrics.LatencyMetric. Request path is not a label,
+// since it contains names of objects.
+type latencyAdapter struct{}
+
+func (latencyAdapter) Observe(verb string, u url.URL, latency time.Duration) {
+	requestLatency.WithLabelValues(verb, u.Host).Observe(latency.Seconds())
+}
+
+// resultAdapter implements clientmetrics.ResultMetric.
+type resultAdapter struct{}
+
+func (resultAdapter) Increment(code, method, host string) {
+	requestResult.WithLabelValues(code, method, host).Inc()
+}
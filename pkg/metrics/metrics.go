@@ -0,0 +1,386 @@
+// Package metrics implements counters, gauges and histograms exposed in the prometheus
+// text format, as the prometheus client library is not vendored.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	CounterType   = "counter"
+	GaugeType     = "gauge"
+	HistogramType = "histogram"
+)
+
+// DefBuckets are the default histogram buckets in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type LabelPair struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	// appended to the family name, e.g. _bucket, _sum and _count of histograms
+	Suffix string
+	Labels []LabelPair
+	Value  float64
+}
+
+// Family is a metric with all its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector collects metric families when scraped.
+type Collector interface {
+	Collect() []*Family
+}
+
+type Registry struct {
+	lock       sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// DefaultRegistry is the registry served by Handler.
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) MustRegister(collectors ...Collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+func MustRegister(collectors ...Collector) {
+	DefaultRegistry.MustRegister(collectors...)
+}
+
+// Gather collects metric families of all collectors, sorted by name.
+func (r *Registry) Gather() []*Family {
+	r.lock.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.lock.Unlock()
+
+	families := []*Family{}
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+	return families
+}
+
+// Handler serves metrics of r in the prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		buf := &bytes.Buffer{}
+		for _, family := range r.Gather() {
+			writeFamily(buf, family)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+func writeFamily(buf *bytes.Buffer, family *Family) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", family.Name, escape(family.Help, false))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", family.Name, family.Type)
+	for _, sample := range family.Samples {
+		buf.WriteString(family.Name + sample.Suffix)
+		if len(sample.Labels) > 0 {
+			pairs := make([]string, 0, len(sample.Labels))
+			for _, label := range sample.Labels {
+				pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label.Name, escape(label.Value, true)))
+			}
+			buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+		}
+		buf.WriteString(" " + formatFloat(sample.Value) + "\n")
+	}
+}
+
+func escape(s string, quoted bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quoted {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricVec keeps the children of a metric by label values.
+type metricVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	lock     sync.Mutex
+	children map[string]interface{}
+	values   map[string][]string
+}
+
+func newMetricVec(name, help string, labelNames []string) metricVec {
+	return metricVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		children:   map[string]interface{}{},
+		values:     map[string][]string{},
+	}
+}
+
+func (v *metricVec) getOrCreate(labelValues []string, create func() interface{}) interface{} {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labelNames),
+			len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child
+	}
+	child := create()
+	v.children[key] = child
+	v.values[key] = append([]string{}, labelValues...)
+	return child
+}
+
+// each calls f on children sorted by label values.
+func (v *metricVec) each(f func(labels []LabelPair, child interface{})) {
+	v.lock.Lock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	children := make([]interface{}, len(keys))
+	labels := make([][]LabelPair, len(keys))
+	for i, key := range keys {
+		children[i] = v.children[key]
+		labels[i] = v.labelPairs(v.values[key])
+	}
+	v.lock.Unlock()
+
+	for i := range keys {
+		f(labels[i], children[i])
+	}
+}
+
+// Reset deletes all children.
+func (v *metricVec) Reset() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.children = map[string]interface{}{}
+	v.values = map[string][]string{}
+}
+
+func (v *metricVec) labelPairs(values []string) []LabelPair {
+	labels := make([]LabelPair, len(values))
+	for i, value := range values {
+		labels[i] = LabelPair{Name: v.labelNames[i], Value: value}
+	}
+	return labels
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	lock  sync.Mutex
+	value float64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("counter cannot decrease")
+	}
+	c.lock.Lock()
+	c.value += delta
+	c.lock.Unlock()
+}
+
+func (c *Counter) get() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.value
+}
+
+type CounterVec struct {
+	metricVec
+}
+
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{metricVec: newMetricVec(name, help, labelNames)}
+}
+
+func (v *CounterVec) WithLabelValues(labelValues ...string) *Counter {
+	return v.getOrCreate(labelValues, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (v *CounterVec) Collect() []*Family {
+	family := &Family{Name: v.name, Help: v.help, Type: CounterType}
+	v.each(func(labels []LabelPair, child interface{}) {
+		family.Samples = append(family.Samples, Sample{Labels: labels, Value: child.(*Counter).get()})
+	})
+	return []*Family{family}
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	lock  sync.Mutex
+	value float64
+}
+
+func (g *Gauge) Set(value float64) {
+	g.lock.Lock()
+	g.value = value
+	g.lock.Unlock()
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.lock.Lock()
+	g.value += delta
+	g.lock.Unlock()
+}
+
+func (g *Gauge) get() float64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.value
+}
+
+type GaugeVec struct {
+	metricVec
+}
+
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{metricVec: newMetricVec(name, help, labelNames)}
+}
+
+func (v *GaugeVec) WithLabelValues(labelValues ...string) *Gauge {
+	return v.getOrCreate(labelValues, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+func (v *GaugeVec) Collect() []*Family {
+	family := &Family{Name: v.name, Help: v.help, Type: GaugeType}
+	v.each(func(labels []LabelPair, child interface{}) {
+		family.Samples = append(family.Samples, Sample{Labels: labels, Value: child.(*Gauge).get()})
+	})
+	return []*Family{family}
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	upperBounds []float64
+
+	lock   sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, bound := range h.upperBounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+type HistogramVec struct {
+	metricVec
+	buckets []float64
+}
+
+// NewHistogramVec creates a HistogramVec with buckets in increasing order, DefBuckets if nil.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	return &HistogramVec{
+		metricVec: newMetricVec(name, help, labelNames),
+		buckets:   buckets,
+	}
+}
+
+func (v *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	return v.getOrCreate(labelValues, func() interface{} {
+		return &Histogram{
+			upperBounds: v.buckets,
+			counts:      make([]uint64, len(v.buckets)),
+		}
+	}).(*Histogram)
+}
+
+func (v *HistogramVec) Collect() []*Family {
+	family := &Family{Name: v.name, Help: v.help, Type: HistogramType}
+	v.each(func(labels []LabelPair, child interface{}) {
+		h := child.(*Histogram)
+		h.lock.Lock()
+		defer h.lock.Unlock()
+
+		for i, bound := range h.upperBounds {
+			family.Samples = append(family.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: append(append([]LabelPair{}, labels...), LabelPair{Name: "le", Value: formatFloat(bound)}),
+				Value:  float64(h.counts[i]),
+			})
+		}
+		family.Samples = append(family.Samples,
+			Sample{
+				Suffix: "_bucket",
+				Labels: append(append([]LabelPair{}, labels...), LabelPair{Name: "le", Value: "+Inf"}),
+				Value:  float64(h.count),
+			},
+			Sample{Suffix: "_sum", Labels: labels, Value: h.sum},
+			Sample{Suffix: "_count", Labels: labels, Value: float64(h.count)},
+		)
+	})
+	return []*Family{family}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"k8s.io/client-go/util/workqueue"
+)
+
+var (
+	workqueueDepth = NewGaugeVec("workqueue_depth",
+		"Current depth of workqueue.", "name")
+	workqueueAdds = NewCounterVec("workqueue_adds_total",
+		"Total number of adds handled by workqueue.", "name")
+	workqueueLatency = NewHistogramVec("workqueue_queue_duration_seconds",
+		"How long in seconds an item stays in workqueue before being requested.", nil, "name")
+	workqueueWorkDuration = NewHistogramVec("workqueue_work_duration_seconds",
+		"How long in seconds processing an item from workqueue takes.", nil, "name")
+	workqueueRetries = NewCounterVec("workqueue_retries_total",
+		"Total number of retries handled by workqueue.", "name")
+)
+
+func init() {
+	MustRegister(workqueueDepth, workqueueAdds, workqueueLatency, workqueueWorkDuration, workqueueRetries)
+	// must be set before named queues are created
+	workqueue.SetProvider(workqueueMetricsProvider{})
+}
+
+// workqueueMetricsProvider implements workqueue.MetricsProvider.
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return microsecondsObserver{workqueueLatency.WithLabelValues(name)}
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	return microsecondsObserver{workqueueWorkDuration.WithLabelValues(name)}
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
+
+// microsecondsObserver converts the microseconds observed by workqueue to seconds.
+type microsecondsObserver struct {
+	histogram *Histogram
+}
+
+func (o microsecondsObserver) Observe(microseconds float64) {
+	o.histogram.Observe(microseconds / 1e6)
+}
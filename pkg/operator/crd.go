@@ -0,0 +1,145 @@
+package operator
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+	"github.com/mathspanda/ws-operator-demo/pkg/k8s"
+)
+
+// CRDManager installs, upgrades and uninstalls the WebServerCluster crd apart from operator,
+// so that operator runs without the rights to write crds.
+type CRDManager struct {
+	kubeConfig *rest.Config
+	crdI       k8s.CRDInterface
+	crd        *k8s.CRD
+
+	logger *log.Entry
+}
+
+func NewCRDManager(kubeConfigPath string) (*CRDManager, error) {
+	kubeConfig, err := k8s.BuildKuberentesConfig(kubeConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	aeClient, err := apiextensionsclient.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &CRDManager{
+		kubeConfig: kubeConfig,
+		crdI:       k8s.NewCRD(aeClient),
+		crd:        NewWebServerClusterCRD(),
+		logger:     log.WithField("service", "crd"),
+	}, nil
+}
+
+// Install creates the crd and waits for it to be established, an installed crd is updated if its
+// validation or subresources are outdated.
+func (m *CRDManager) Install() error {
+	if _, err := m.crdI.Create(m.crdI.MakeConfig(k8s.NewCRDData(m.crd))); err != nil {
+		return err
+	}
+	m.logger.Infof("Successfully install crd %s.", m.crd.Name)
+	return nil
+}
+
+// Upgrade replaces the spec of the installed crd with the one of this version, or installs it.
+func (m *CRDManager) Upgrade() error {
+	_, err := m.crdI.Get(m.crd.Name)
+	if apierrors.IsNotFound(err) {
+		return m.Install()
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := m.crdI.Update(m.crdI.MakeConfig(k8s.NewCRDData(m.crd))); err != nil {
+		return err
+	}
+	m.logger.Infof("Successfully upgrade crd %s.", m.crd.Name)
+	return nil
+}
+
+// Uninstall deletes the crd. It refuses to delete the crd while WebServerClusters exist unless force
+// is set, in which case WebServerClusters are deleted first, and their finalizers must be run by
+// operator within timeout.
+func (m *CRDManager) Uninstall(force bool, timeout time.Duration) error {
+	if _, err := m.crdI.Get(m.crd.Name); err != nil {
+		if apierrors.IsNotFound(err) {
+			m.logger.Infof("Crd %s is not installed.", m.crd.Name)
+			return nil
+		}
+		return err
+	}
+
+	crdClient, _, err := m.crdI.NewRestClient(&k8s.CRDRestClientConfig{
+		KubeConfig: m.kubeConfig,
+		CRD:        m.crd,
+	})
+	if err != nil {
+		return err
+	}
+	list, err := m.listWebServerClusters(crdClient)
+	if err != nil {
+		return err
+	}
+	if len(list.Items) > 0 {
+		if !force {
+			return fmt.Errorf("%d WebServerClusters exist, delete them or uninstall with force", len(list.Items))
+		}
+		if err := m.drain(crdClient, list, timeout); err != nil {
+			return err
+		}
+	}
+
+	if err := m.crdI.Delete(m.crd.Name, nil); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	m.logger.Infof("Successfully uninstall crd %s.", m.crd.Name)
+	return nil
+}
+
+// drain deletes WebServerClusters in list, and waits for them to disappear.
+func (m *CRDManager) drain(crdClient *rest.RESTClient, list *v1.WebServerClusterList, timeout time.Duration) error {
+	for _, ws := range list.Items {
+		m.logger.Infof("Delete WebServerCluster %s/%s", ws.Namespace, ws.Name)
+		err := crdClient.Delete().
+			Namespace(ws.Namespace).
+			Resource(m.crd.Plural).
+			Name(ws.Name).
+			Do().
+			Error()
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	err := wait.Poll(2*time.Second, timeout, func() (bool, error) {
+		list, err := m.listWebServerClusters(crdClient)
+		if err != nil {
+			return false, err
+		}
+		return len(list.Items) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("WebServerClusters are not deleted within %v, their finalizers are run by operator, "+
+			"make sure it is running", timeout)
+	}
+	return err
+}
+
+func (m *CRDManager) listWebServerClusters(crdClient *rest.RESTClient) (*v1.WebServerClusterList, error) {
+	list := &v1.WebServerClusterList{}
+	err := crdClient.Get().
+		Resource(m.crd.Plural).
+		Do().
+		Into(list)
+	return list, err
+}
@@ -0,0 +1,118 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"sync/atomic"
+
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/metrics"
+)
+
+// startHTTPServer serves /metrics, /healthz, /readyz, and optional /plan and /debug until ctx is done.
+func (o *operator) startHTTPServer(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", o.serveHealthz)
+	mux.HandleFunc("/readyz", o.serveReadyz)
+	if o.dryRunPlan != nil {
+		mux.HandleFunc("/plan", o.servePlan)
+	}
+	if o.enableDebug {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		mux.HandleFunc("/debug/stores", o.serveDebugStores)
+		mux.HandleFunc("/debug/queue", o.serveDebugQueue)
+	}
+
+	server := &http.Server{
+		Addr:    o.metricsAddress,
+		Handler: mux,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	go func() {
+		o.logger.Infof("Begin to serve metrics and probes on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			o.logger.Errorf("HTTP server exits: %v", err)
+		}
+	}()
+}
+
+// serveHealthz fails if a worker is stuck, so that kubelet restarts operator.
+func (o *operator) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	if err := o.wsController.CheckWorkers(o.stuckTimeout); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// serveReadyz passes after crd is established and informer caches are synced.
+func (o *operator) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	if !o.isReady() {
+		http.Error(w, "crd is not established or informer caches are not synced", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func (o *operator) isReady() bool {
+	return atomic.LoadInt32(&o.ready) == 1
+}
+
+// serveDebugStores dumps objects in informer stores.
+func (o *operator) serveDebugStores(w http.ResponseWriter, r *http.Request) {
+	// stores are set before ready
+	if !o.isReady() {
+		http.Error(w, "informer caches are not synced", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, map[string][]interface{}{
+		o.crd.Plural:  listSorted(o.crdStore),
+		"deployments": listSorted(o.deployStore),
+		"services":    listSorted(o.svcStore),
+	})
+}
+
+// serveDebugQueue dumps queued and processing WebServerCluster keys.
+func (o *operator) serveDebugQueue(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, o.wsController.DumpQueue())
+}
+
+// servePlan dumps the latest planned change of each object in dry-run mode.
+func (o *operator) servePlan(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, o.dryRunPlan.Changes())
+}
+
+func listSorted(store cache.Store) []interface{} {
+	keys := store.ListKeys()
+	sort.Strings(keys)
+	objs := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		if obj, exists, err := store.GetByKey(key); err == nil && exists {
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,153 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+// namespaceFilter decides which namespaces are served, by a list of namespaces and
+// a namespace label selector. Namespaces matching the selector are tracked by an informer,
+// so that namespaces gaining or losing the labels are served or released at runtime.
+type namespaceFilter struct {
+	// all namespaces if empty
+	namespaces map[string]bool
+	// nil if no selector is set
+	selector labels.Selector
+	// informer store of namespaces matching selector
+	store cache.Store
+}
+
+func newNamespaceFilter(namespaces []string, selector string) (*namespaceFilter, error) {
+	f := &namespaceFilter{namespaces: map[string]bool{}}
+	for _, namespace := range namespaces {
+		if namespace != "" {
+			f.namespaces[namespace] = true
+		}
+	}
+	if selector != "" {
+		s, err := labels.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+		f.selector = s
+	}
+	return f, nil
+}
+
+// listNamespace returns the namespace which informers list and watch, metav1.NamespaceAll
+// unless exactly one namespace is served. Multiple namespaces are watched cluster-wide and
+// filtered by Contains, so operator needs cluster-wide rights to list and watch.
+func (f *namespaceFilter) listNamespace() string {
+	if len(f.namespaces) == 1 {
+		for namespace := range f.namespaces {
+			return namespace
+		}
+	}
+	return metav1.NamespaceAll
+}
+
+// Contains returns whether namespace is in the list, and matches the selector.
+func (f *namespaceFilter) Contains(namespace string) bool {
+	if len(f.namespaces) > 0 && !f.namespaces[namespace] {
+		return false
+	}
+	if f.selector == nil {
+		return true
+	}
+	_, exists, err := f.store.GetByKey(namespace)
+	return err == nil && exists
+}
+
+func (f *namespaceFilter) String() string {
+	s := "all namespaces"
+	if len(f.namespaces) > 0 {
+		namespaces := make([]string, 0, len(f.namespaces))
+		for namespace := range f.namespaces {
+			namespaces = append(namespaces, namespace)
+		}
+		sort.Strings(namespaces)
+		s = strings.Join(namespaces, ",")
+	}
+	if f.selector != nil {
+		s += " selected by " + f.selector.String()
+	}
+	return s
+}
+
+// newNamespaceInformer creates the informer of namespaces matching the selector, whose store
+// backs the filter before the informer runs.
+func (o *operator) newNamespaceInformer() cache.Controller {
+	selector := o.namespaceFilter.selector.String()
+	store, controller := cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = selector
+				return o.kubeClient.CoreV1().Namespaces().List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = selector
+				return o.kubeClient.CoreV1().Namespaces().Watch(options)
+			},
+		},
+		&apiv1.Namespace{},
+		o.resyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    o.onNamespaceAdd,
+			DeleteFunc: o.onNamespaceDelete,
+		},
+	)
+	o.namespaceFilter.store = store
+	return controller
+}
+
+// watchNamespaces runs the namespace informer if any, and waits for it to be synced. It must be called
+// before the WebServerCluster informer runs, otherwise its initial WebServerClusters are dropped
+// as their namespaces are not known yet.
+func (o *operator) watchNamespaces(ctx context.Context) error {
+	if o.namespaceInformer == nil {
+		return nil
+	}
+
+	go o.namespaceInformer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), o.namespaceInformer.HasSynced) {
+		return errors.New("failed to sync namespace informer")
+	}
+	return nil
+}
+
+// onNamespaceAdd enqueues WebServerClusters of the namespace which gains the labels.
+func (o *operator) onNamespaceAdd(obj interface{}) {
+	ns, ok := obj.(*apiv1.Namespace)
+	if !ok || !o.namespaceFilter.Contains(ns.Name) {
+		return
+	}
+	o.logger.Infof("Begin to serve namespace %s.", ns.Name)
+	for _, obj := range o.crdStore.List() {
+		if ws, ok := obj.(*v1.WebServerCluster); ok && ws.Namespace == ns.Name {
+			o.wsController.Enqueue(ws)
+		}
+	}
+}
+
+// onNamespaceDelete releases the namespace which loses the labels or is deleted, its WebServerClusters
+// are left as they are, and their queued keys are skipped.
+func (o *operator) onNamespaceDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if ns, ok := obj.(*apiv1.Namespace); ok && (len(o.namespaceFilter.namespaces) == 0 ||
+		o.namespaceFilter.namespaces[ns.Name]) {
+		o.logger.Infof("Stop serving namespace %s.", ns.Name)
+	}
+}
@@ -2,16 +2,24 @@ package operator
 
 import (
 	"context"
-	"reflect"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
 	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
@@ -19,6 +27,10 @@ import (
 	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
 	"github.com/mathspanda/ws-operator-demo/pkg/controller"
 	"github.com/mathspanda/ws-operator-demo/pkg/k8s"
+	"github.com/mathspanda/ws-operator-demo/pkg/leaderelection"
+	"github.com/mathspanda/ws-operator-demo/pkg/metrics"
+	"github.com/mathspanda/ws-operator-demo/pkg/record"
+	"github.com/mathspanda/ws-operator-demo/pkg/webhook"
 )
 
 type OperatorInterface interface {
@@ -26,18 +38,68 @@ type OperatorInterface interface {
 	DeleteCRD(string, *metav1.DeleteOptions) error
 	// start controller to handle add/update/delete events
 	WatchEvents(context.Context, *k8s.CRD) error
-	Run(ctx context.Context, stopCh <-chan struct{}) error
+	// Run runs until ctx is done, and then shuts down gracefully
+	Run(ctx context.Context) error
 }
 
 type OperatorConfig struct {
 	KubeConfigPath string
-	WatchNamespace string
-	ResyncPeriod   time.Duration
+	// namespaces which operator serves, all namespaces if empty
+	WatchNamespaces []string
+	// label selector of namespaces which operator serves, in addition to WatchNamespaces
+	NamespaceSelector string
+	// label selector of WebServerClusters which operator serves, all if empty
+	Selector string
+	// sharding is disabled if nil
+	Shard        *ShardConfig
+	ResyncPeriod time.Duration
+	// number of workers reconciling WebServerClusters concurrently
+	Workers int
+	// defaults of unspecified WebServerCluster spec fields
+	Defaults *v1.WebServerClusterDefaults
+	// admission webhook server is disabled if nil
+	Webhook *webhook.Config
+	// leader election is disabled if nil, and workers always run
+	LeaderElection *LeaderElectionConfig
+	// address of the http server serving /metrics, /healthz and /readyz, disabled if empty
+	MetricsAddress string
+	// serve /debug with pprof, informer stores and queue contents
+	EnableDebug bool
+	// /healthz fails if a worker reconciles a WebServerCluster longer than it
+	WorkerStuckTimeout time.Duration
+	// duration to wait for in-flight WebServerClusters to be reconciled on shutdown
+	ShutdownGracePeriod time.Duration
+	// plan changes without writing anything, leader election and webhook are disabled
+	DryRun bool
+	// crd is installed by `crd install` rather than operator, which then only checks it exists
+	SkipCRDInstall bool
+}
+
+type LeaderElectionConfig struct {
+	// leaderelection.ConfigMapsResourceLock or leaderelection.LeasesResourceLock
+	ResourceLock string
+	// namespace and name of the lock object
+	Namespace string
+	Name      string
+	// hostname with random suffix if empty
+	Identity string
+
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
 }
 
 type operator struct {
-	watchNamespace string
 	resyncPeriod   time.Duration
+	workers        int
+	webhookConfig  *webhook.Config
+	leaderElection *LeaderElectionConfig
+	gracePeriod    time.Duration
+	metricsAddress string
+	enableDebug    bool
+	stuckTimeout   time.Duration
+	// set when crd is established and informer caches are synced
+	ready int32
 
 	kubeConfig *rest.Config
 	// k8s clientset
@@ -46,11 +108,33 @@ type operator struct {
 	aeClient *apiextensionsclient.Clientset
 
 	wsController *controller.WSController
+	recorder     *record.Recorder
+	// closed after workers are shut down, so that their last events are written
+	recorderStopCh chan struct{}
+	// closed after the recorder writes the queued events
+	recorderDone chan struct{}
+	elector      *leaderelection.LeaderElector
 
 	crdI k8s.CRDInterface
 	crd  *k8s.CRD
+	// set by WatchEvents
+	crdRestClient *rest.RESTClient
+
+	crdStore    cache.Store
+	deployStore cache.Store
+	svcStore    cache.Store
 
-	crdStore cache.Store
+	namespaceFilter *namespaceFilter
+	// runs if namespace selector is set
+	namespaceInformer cache.Controller
+
+	// label selector and shard of WebServerClusters served by this instance
+	selector string
+	shard    *ShardConfig
+
+	// nil unless in dry-run mode
+	dryRunPlan     *k8s.Plan
+	skipCRDInstall bool
 
 	logger *log.Entry
 }
@@ -68,39 +152,95 @@ func NewOperator(config *OperatorConfig) (OperatorInterface, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	crd := &k8s.CRD{
-		Name:          v1.CRDName,
-		Kind:          v1.CRDKind,
-		Plural:        v1.CRDPlural,
-		Group:         v1.CRDGroup,
-		Version:       v1.CRDVersion,
-		Scope:         apiextensionsv1beta1.NamespaceScoped,
-		Obj:           &v1.WebServerCluster{},
-		ObjList:       &v1.WebServerClusterList{},
-		SchemeBuilder: v1.AddKnownTypes,
+	namespaceFilter, err := newNamespaceFilter(config.WatchNamespaces, config.NamespaceSelector)
+	if err != nil {
+		return nil, err
 	}
 
+	crd := NewWebServerClusterCRD()
+
+	recorder := record.NewRecorder(kubeClient.CoreV1(), "ws-operator-demo")
+	var eventRecorder record.EventRecorder = recorder
+	var plan *k8s.Plan
+	if config.DryRun {
+		// events are writes as well
+		eventRecorder = nil
+		plan = k8s.NewPlan()
+	}
+	// metrics provider of workqueue is set when importing metrics package, before the queue is created
 	controller := controller.NewWSController(&controller.WSControllerConfig{
-		KubeConfig:   kubeConfig,
-		AEClient:     aeClient,
-		KubeClient:   kubeClient,
-		Namespace:    config.WatchNamespace,
-		ResyncPeriod: config.ResyncPeriod,
-		Crd:          crd,
+		KubeConfig:      kubeConfig,
+		AEClient:        aeClient,
+		KubeClient:      kubeClient,
+		Namespace:       namespaceFilter.listNamespace(),
+		NamespaceFilter: namespaceFilter.Contains,
+		ResyncPeriod:    config.ResyncPeriod,
+		Crd:             crd,
+		Defaults:        config.Defaults,
+		Recorder:        eventRecorder,
+		DryRunPlan:      plan,
 	})
 
-	return &operator{
-		watchNamespace: config.WatchNamespace,
+	metrics.MustRegister(controller)
+
+	o := &operator{
 		resyncPeriod:   config.ResyncPeriod,
+		workers:        config.Workers,
+		webhookConfig:  config.Webhook,
+		leaderElection: config.LeaderElection,
+		gracePeriod:    config.ShutdownGracePeriod,
+		metricsAddress: config.MetricsAddress,
+		enableDebug:    config.EnableDebug,
+		stuckTimeout:   config.WorkerStuckTimeout,
 		kubeConfig:     kubeConfig,
 		kubeClient:     kubeClient,
 		aeClient:       aeClient,
 		crdI:           k8s.NewCRD(aeClient),
 		crd:            crd,
 		wsController:   controller,
+		recorder:       recorder,
+		recorderStopCh: make(chan struct{}),
+		recorderDone:   make(chan struct{}),
 		logger:         log.WithField("app", "operator"),
-	}, nil
+	}
+	o.namespaceFilter = namespaceFilter
+	o.selector = config.Selector
+	o.skipCRDInstall = config.SkipCRDInstall || config.DryRun
+	o.shard = config.Shard
+	if config.DryRun {
+		// never take over leadership or admission from the operator in charge
+		o.dryRunPlan = plan
+		o.leaderElection = nil
+		o.webhookConfig = nil
+	}
+	if namespaceFilter.selector != nil {
+		o.namespaceInformer = o.newNamespaceInformer()
+	}
+	return o, nil
+}
+
+// NewWebServerClusterCRD returns the definition of WebServerCluster crd.
+func NewWebServerClusterCRD() *k8s.CRD {
+	selectorPath := ".status.selector"
+	return &k8s.CRD{
+		Name:    v1.CRDName,
+		Kind:    v1.CRDKind,
+		Plural:  v1.CRDPlural,
+		Group:   v1.CRDGroup,
+		Version: v1.CRDVersion,
+		Scope:   apiextensionsv1beta1.NamespaceScoped,
+		Subresources: &k8s.CustomResourceSubresources{
+			Status: &k8s.CustomResourceSubresourceStatus{},
+			Scale: &k8s.CustomResourceSubresourceScale{
+				SpecReplicasPath:   ".spec.replicas",
+				StatusReplicasPath: ".status.replicas",
+				LabelSelectorPath:  &selectorPath,
+			},
+		},
+		Obj:           &v1.WebServerCluster{},
+		ObjList:       &v1.WebServerClusterList{},
+		SchemeBuilder: v1.AddKnownTypes,
+	}
 }
 
 func (o *operator) CreateCRD(crd *k8s.CRD) error {
@@ -122,72 +262,323 @@ func (o *operator) WatchEvents(ctx context.Context, crd *k8s.CRD) error {
 	if err != nil {
 		return err
 	}
+	o.crdRestClient = crdRestClient
+	if o.shard != nil {
+		o.logger.Infof("Serve shard %d of %d.", o.shard.Index, o.shard.Count)
+	}
 
+	// informers list all namespaces unless exactly one is served, events out of
+	// served namespaces are dropped by controller
+	watchNamespace := o.namespaceFilter.listNamespace()
 	crdStore, crdController := cache.NewIndexerInformer(
-		cache.NewListWatchFromClient(
-			crdRestClient,
-			o.crd.Plural,
-			o.watchNamespace,
-			fields.Everything(),
-		),
+		o.newWebServerClusterListWatch(crdRestClient, watchNamespace),
 		o.crd.Obj,
 		o.resyncPeriod,
 		o.wsController,
 		cache.Indexers{},
 	)
 	o.crdStore = crdStore
+	o.wsController.SetStore(crdStore)
+
+	// only deployments and services labeled by operator are cached
+	ownedSelector := labels.SelectorFromSet(labels.Set{
+		controller.ManagedByLabelKey: controller.ManagedByLabel,
+	}).String()
+	ownedIndexers := cache.Indexers{k8s.OwnerUIDIndex: k8s.OwnerUIDIndexFunc}
 
-	_, deployController := cache.NewIndexerInformer(
-		cache.NewListWatchFromClient(
-			o.kubeClient.ExtensionsV1beta1().RESTClient(),
-			"deployments",
-			o.watchNamespace,
-			fields.Everything()),
+	deployInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = ownedSelector
+				return o.kubeClient.ExtensionsV1beta1().Deployments(watchNamespace).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = ownedSelector
+				return o.kubeClient.ExtensionsV1beta1().Deployments(watchNamespace).Watch(options)
+			},
+		},
 		&extensionsv1beta1.Deployment{},
 		o.resyncPeriod,
-		cache.ResourceEventHandlerFuncs{
-			UpdateFunc: o.updateCRDStatusByDeploy,
+		ownedIndexers,
+	)
+	deployInformer.AddEventHandler(o.newOwnedObjectHandler())
+
+	svcInformer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = ownedSelector
+				return o.kubeClient.CoreV1().Services(watchNamespace).List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = ownedSelector
+				return o.kubeClient.CoreV1().Services(watchNamespace).Watch(options)
+			},
 		},
-		cache.Indexers{},
+		&apiv1.Service{},
+		o.resyncPeriod,
+		ownedIndexers,
 	)
+	svcInformer.AddEventHandler(o.newOwnedObjectHandler())
+
+	o.deployStore = deployInformer.GetIndexer()
+	o.svcStore = svcInformer.GetIndexer()
+	o.wsController.SetListers(k8s.NewDeploymentLister(deployInformer.GetIndexer()),
+		k8s.NewServiceLister(svcInformer.GetIndexer()))
 
-	go wait.Until(o.wsController.Worker, time.Second, ctx.Done())
+	if err := o.watchNamespaces(ctx); err != nil {
+		return err
+	}
 
 	go crdController.Run(ctx.Done())
-	go deployController.Run(ctx.Done())
+	go deployInformer.Run(ctx.Done())
+	go svcInformer.Run(ctx.Done())
 
+	if !cache.WaitForCacheSync(ctx.Done(), crdController.HasSynced, deployInformer.HasSynced,
+		svcInformer.HasSynced) {
+		return errors.New("failed to sync informers")
+	}
 	return nil
 }
 
-func (o *operator) updateCRDStatusByDeploy(oldObj, newObj interface{}) {
-	oldDeploy := oldObj.(*extensionsv1beta1.Deployment)
-	newDeploy := newObj.(*extensionsv1beta1.Deployment)
+// runWorkers sweeps orphans and starts workers to reconcile queued WebServerClusters,
+// it only runs on the leader if leader election is enabled.
+func (o *operator) runWorkers(ctx context.Context) {
+	if err := o.wsController.SweepOrphans(); err != nil {
+		o.logger.Warnf("Failed to sweep orphan deployments and services: %v", err)
+	}
 
-	if oldDeploy.ResourceVersion != newDeploy.ResourceVersion &&
-		!reflect.DeepEqual(oldDeploy.Status, newDeploy.Status) {
-		crd, exists, err := o.crdStore.GetByKey(newDeploy.GetNamespace() + "/" + newDeploy.GetName())
+	o.wsController.Run(o.workers, ctx.Done())
+}
+
+// newOwnedObjectHandler handles the events of deployments and services owned by WebServerClusters,
+// so that their status changes are reflected and their drifts and deletions are reverted.
+func (o *operator) newOwnedObjectHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldMeta, err := meta.Accessor(oldObj)
+			if err != nil {
+				return
+			}
+			newMeta, err := meta.Accessor(newObj)
+			if err != nil {
+				return
+			}
+			// periodic resync, WebServerClusters are resynced by their own informer
+			if oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+				return
+			}
+			o.enqueueOwner(newObj)
+		},
+		DeleteFunc: o.enqueueOwner,
+	}
+}
+
+// enqueueOwner enqueues the WebServerCluster which owns obj.
+func (o *operator) enqueueOwner(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+
+	apiVersion := o.crd.Group + "/" + o.crd.Version
+	for _, owner := range objMeta.GetOwnerReferences() {
+		if owner.Kind != o.crd.Kind || owner.APIVersion != apiVersion {
+			continue
+		}
+		crd, exists, err := o.crdStore.GetByKey(objMeta.GetNamespace() + "/" + owner.Name)
 		if err != nil || !exists {
-			return
+			continue
+		}
+		if ws := crd.(*v1.WebServerCluster); ws.UID == owner.UID {
+			o.wsController.Enqueue(ws)
 		}
-		ws := crd.(*v1.WebServerCluster)
-		o.wsController.UpdateStatus(ws, &v1.WebServerClusterStatus{
-			Replicas: newDeploy.Status.Replicas,
-		})
 	}
 }
 
-func (o *operator) Run(ctx context.Context, stopCh <-chan struct{}) error {
-	o.logger.Info("Begin to create crd.")
-	if err := o.CreateCRD(o.crd); err != nil {
-		return err
+func (o *operator) Run(ctx context.Context) error {
+	if o.metricsAddress != "" {
+		o.startHTTPServer(ctx)
+	}
+	go func() {
+		defer close(o.recorderDone)
+		o.recorder.Run(o.recorderStopCh)
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := o.start(ctx); err != nil {
+		// stop what is started before the failure, e.g. informers, leader election and workers
+		cancel()
+		return utilerrors.NewAggregate([]error{err, o.shutDown()})
+	}
+
+	<-ctx.Done()
+	return o.shutDown()
+}
+
+// start installs the crd, starts informers, and then runs workers and the webhook server.
+func (o *operator) start(ctx context.Context) error {
+	if o.dryRunPlan != nil {
+		o.logger.Info("Run in dry-run mode, changes are planned without being written.")
+	}
+	if o.skipCRDInstall {
+		o.logger.Info("Begin to wait for crd to be established.")
+		if err := o.crdI.WaitEstablished(o.crd.Name); err != nil {
+			return fmt.Errorf("crd %s is not established, install it by `crd install`: %v", o.crd.Name, err)
+		}
+	} else {
+		o.logger.Info("Begin to create crd.")
+		if err := o.CreateCRD(o.crd); err != nil {
+			return err
+		}
+		o.logger.Info("Successfully create crd.")
 	}
-	o.logger.Info("Successfully create crd.")
 
-	o.logger.Info("Begin to watch events.")
+	o.logger.Infof("Begin to watch events in %s.", o.namespaceFilter)
 	if err := o.WatchEvents(ctx, o.crd); err != nil {
 		return err
 	}
+	atomic.StoreInt32(&o.ready, 1)
+
+	if o.leaderElection != nil {
+		o.logger.Info("Begin to run leader election.")
+		if err := o.runLeaderElection(ctx); err != nil {
+			return err
+		}
+	} else {
+		o.runWorkers(ctx)
+	}
+
+	if o.webhookConfig != nil {
+		o.logger.Info("Begin to start admission webhook server.")
+		if err := o.startWebhookServer(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shutDown waits for workers to finish in-flight WebServerClusters, and then releases
+// the leadership so that a standby replica takes over without waiting for the lease to expire.
+func (o *operator) shutDown() error {
+	o.logger.Info("Begin to shut down.")
+	err := o.wsController.ShutDown(o.gracePeriod)
+	close(o.recorderStopCh)
+	<-o.recorderDone
+	if err != nil {
+		return err
+	}
+	if o.elector != nil && o.elector.Release() {
+		o.logger.Info("Successfully release leadership.")
+	}
+	o.logger.Info("Successfully shut down.")
+	return nil
+}
+
+// runLeaderElection runs workers when this replica becomes leader. Informers of standby replicas
+// keep running, so that the new leader takes over with warm caches.
+func (o *operator) runLeaderElection(ctx context.Context) error {
+	config := o.leaderElection
+	identity := config.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		identity = hostname + "_" + rand.String(5)
+	}
+
+	lock, err := leaderelection.NewResourceLock(config.ResourceLock, o.kubeConfig, o.kubeClient.CoreV1(),
+		leaderelection.ResourceLockConfig{
+			Identity:  identity,
+			Namespace: config.Namespace,
+			Name:      config.Name,
+		})
+	if err != nil {
+		return err
+	}
+
+	elector, err := leaderelection.NewLeaderElector(&leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: config.LeaseDuration,
+		RenewDeadline: config.RenewDeadline,
+		RetryPeriod:   config.RetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				o.logger.Infof("Become leader %s, begin to run workers.", identity)
+				o.runWorkers(leaderCtx)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil {
+					return
+				}
+				// workers may be in the middle of reconciling, exit to make sure they stop
+				o.logger.Fatalf("Leader election of %s is lost.", identity)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
 
-	<-stopCh
+	o.elector = elector
+	go elector.Run(ctx)
 	return nil
 }
+
+func (o *operator) startWebhookServer(ctx context.Context) error {
+	webhookI, err := k8s.NewWebhookConfiguration(o.kubeConfig)
+	if err != nil {
+		return err
+	}
+	server := webhook.NewServer(o.webhookConfig, o)
+	if err := server.Register(webhookI); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := server.Run(ctx); err != nil {
+			o.logger.Errorf("Admission webhook server exits: %v", err)
+		}
+	}()
+	return nil
+}
+
+// ListClusters implements webhook.ClusterLister with the informer store. The store only caches
+// the subset served by this instance if namespaces, selector or shard is set, while node ports are
+// cluster-wide, so WebServerClusters of all namespaces are listed from api server instead.
+func (o *operator) ListClusters() ([]*v1.WebServerCluster, error) {
+	if o.crdStore == nil {
+		return nil, errors.New("WebServerCluster informer is not started")
+	}
+	partial := len(o.namespaceFilter.namespaces) > 0 || o.namespaceFilter.selector != nil ||
+		o.selector != "" || o.shard != nil
+	if partial {
+		list := &v1.WebServerClusterList{}
+		err := o.crdRestClient.Get().
+			Namespace(metav1.NamespaceAll).
+			Resource(o.crd.Plural).
+			Do().
+			Into(list)
+		if err != nil {
+			return nil, err
+		}
+		clusters := make([]*v1.WebServerCluster, 0, len(list.Items))
+		for i := range list.Items {
+			clusters = append(clusters, &list.Items[i])
+		}
+		return clusters, nil
+	}
+	objs := o.crdStore.List()
+	clusters := make([]*v1.WebServerCluster, 0, len(objs))
+	for _, obj := range objs {
+		if ws, ok := obj.(*v1.WebServerCluster); ok {
+			clusters = append(clusters, ws)
+		}
+	}
+	return clusters, nil
+}
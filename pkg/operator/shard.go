@@ -0,0 +1,79 @@
+package operator
+
+import (
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ShardConfig splits WebServerClusters among operator instances by the hash of namespace/name,
+// an instance serves the WebServerClusters whose hash modulo Count equals Index.
+type ShardConfig struct {
+	Index int
+	Count int
+}
+
+// inShard returns whether the WebServerCluster belongs to the shard, all belong if shard is nil.
+func (s *ShardConfig) inShard(namespace, name string) bool {
+	if s == nil {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(namespace + "/" + name))
+	return int(h.Sum32()%uint32(s.Count)) == s.Index
+}
+
+// newWebServerClusterListWatch lists and watches the WebServerClusters matching the selector on
+// api server, and drops those out of the shard, so that the informer only caches the subset served
+// by this instance. WebServerClusters which stop matching the selector are watched as deleted.
+func (o *operator) newWebServerClusterListWatch(client cache.Getter, namespace string) *cache.ListWatch {
+	lw := cache.NewListWatchFromClient(client, o.crd.Plural, namespace, fields.Everything())
+	listFunc, watchFunc := lw.ListFunc, lw.WatchFunc
+
+	lw.ListFunc = func(options metav1.ListOptions) (runtime.Object, error) {
+		options.LabelSelector = o.selector
+		list, err := listFunc(options)
+		if err != nil || o.shard == nil {
+			return list, err
+		}
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		inShard := make([]runtime.Object, 0, len(objs))
+		for _, obj := range objs {
+			if o.objInShard(obj) {
+				inShard = append(inShard, obj)
+			}
+		}
+		if err := meta.SetList(list, inShard); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+	lw.WatchFunc = func(options metav1.ListOptions) (watch.Interface, error) {
+		options.LabelSelector = o.selector
+		w, err := watchFunc(options)
+		if err != nil || o.shard == nil {
+			return w, err
+		}
+		// the shard of a WebServerCluster never changes, as namespace and name are immutable
+		return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+			return event, event.Type == watch.Error || o.objInShard(event.Object)
+		}), nil
+	}
+	return lw
+}
+
+func (o *operator) objInShard(obj runtime.Object) bool {
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	return o.shard.inShard(objMeta.GetNamespace(), objMeta.GetName())
+}
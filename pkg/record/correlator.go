@@ -0,0 +1,99 @@
+package record
+
+import (
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/clock"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// events of the same object, type and reason with more distinct messages than it
+	// within aggregateInterval are combined into one event
+	maxSimilarEvents  = 10
+	aggregateInterval = 10 * time.Minute
+
+	combinedMessagePrefix = "(combined from similar events): "
+
+	// caches are reset when exceeding it
+	maxCacheEntries = 4096
+)
+
+type similarEvents struct {
+	messages map[string]bool
+	since    time.Time
+}
+
+// correlator combines similar events, and deduplicates identical events by increasing
+// the count of the recorded one. It is only used by the goroutine writing events.
+type correlator struct {
+	clock clock.Clock
+
+	// aggregate key -> distinct messages
+	similar map[string]*similarEvents
+	// dedup key -> the last written event
+	recorded map[string]*apiv1.Event
+}
+
+func newCorrelator(c clock.Clock) *correlator {
+	return &correlator{
+		clock:    c,
+		similar:  map[string]*similarEvents{},
+		recorded: map[string]*apiv1.Event{},
+	}
+}
+
+// correlate returns the event to write, its dedup key, and whether it updates an existing event.
+func (c *correlator) correlate(event *apiv1.Event) (*apiv1.Event, string, bool) {
+	now := c.clock.Now()
+	aggregateKey := getAggregateKey(event)
+
+	similar, ok := c.similar[aggregateKey]
+	if !ok || now.Sub(similar.since) > aggregateInterval {
+		if len(c.similar) >= maxCacheEntries {
+			c.similar = map[string]*similarEvents{}
+		}
+		similar = &similarEvents{messages: map[string]bool{}, since: now}
+		c.similar[aggregateKey] = similar
+	}
+	similar.messages[event.Message] = true
+
+	key := aggregateKey + "\x00" + event.Message
+	if len(similar.messages) >= maxSimilarEvents {
+		key = aggregateKey + "\x00" + combinedMessagePrefix
+		event.Message = combinedMessagePrefix + event.Message
+	}
+
+	recorded, ok := c.recorded[key]
+	if !ok {
+		return event, key, false
+	}
+	updated := *recorded
+	updated.Message = event.Message
+	updated.Count = recorded.Count + 1
+	updated.LastTimestamp = event.LastTimestamp
+	return &updated, key, true
+}
+
+// observe records the written event of key.
+func (c *correlator) observe(key string, event *apiv1.Event) {
+	if _, ok := c.recorded[key]; !ok && len(c.recorded) >= maxCacheEntries {
+		c.recorded = map[string]*apiv1.Event{}
+	}
+	c.recorded[key] = event
+}
+
+func getAggregateKey(event *apiv1.Event) string {
+	return strings.Join([]string{
+		event.Source.Component,
+		event.Source.Host,
+		event.InvolvedObject.Kind,
+		event.InvolvedObject.Namespace,
+		event.InvolvedObject.Name,
+		string(event.InvolvedObject.UID),
+		event.InvolvedObject.APIVersion,
+		event.Type,
+		event.Reason,
+	}, "\x00")
+}
@@ -0,0 +1,142 @@
+// Package record records kubernetes events on objects, following client-go tools/record
+// which is not in the vendored client-go. Events are written asynchronously, and repeated
+// or similar events are aggregated to avoid flooding the api server.
+package record
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// events are dropped if the buffer is full
+	maxQueuedEvents = 1000
+	// queued events are dropped if they are not written within it after stop
+	drainTimeout = 5 * time.Second
+)
+
+type EventRecorder interface {
+	// Event records an event of eventType, apiv1.EventTypeNormal or apiv1.EventTypeWarning,
+	// on the referenced object. reason is a short CamelCase word.
+	Event(ref *apiv1.ObjectReference, eventType, reason, message string)
+	Eventf(ref *apiv1.ObjectReference, eventType, reason, messageFmt string, args ...interface{})
+}
+
+type Recorder struct {
+	client corev1client.EventsGetter
+	source apiv1.EventSource
+	clock  clock.Clock
+
+	events     chan *apiv1.Event
+	correlator *correlator
+
+	logger *log.Entry
+}
+
+// NewRecorder creates a Recorder for component, which writes events after Run.
+func NewRecorder(client corev1client.EventsGetter, component string) *Recorder {
+	c := clock.RealClock{}
+	return &Recorder{
+		client:     client,
+		source:     apiv1.EventSource{Component: component},
+		clock:      c,
+		events:     make(chan *apiv1.Event, maxQueuedEvents),
+		correlator: newCorrelator(c),
+		logger:     log.WithField("service", "recorder"),
+	}
+}
+
+func (r *Recorder) Event(ref *apiv1.ObjectReference, eventType, reason, message string) {
+	now := metav1.NewTime(r.clock.Now())
+	event := &apiv1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%s", ref.Name, strconv.FormatInt(now.UnixNano(), 16)),
+			Namespace: ref.Namespace,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		Source:         r.source,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           eventType,
+	}
+
+	select {
+	case r.events <- event:
+	default:
+		r.logger.Warnf("Drop event %s of %s/%s, too many events queued", reason, ref.Namespace, ref.Name)
+	}
+}
+
+func (r *Recorder) Eventf(ref *apiv1.ObjectReference, eventType, reason, messageFmt string,
+	args ...interface{}) {
+	r.Event(ref, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// Run writes recorded events until stopCh is closed, and then returns after writing the queued
+// events within drainTimeout, so that the events of last reconciles are not lost on shutdown.
+func (r *Recorder) Run(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			r.drain()
+			return
+		case event := <-r.events:
+			r.write(event)
+		}
+	}
+}
+
+// drain writes the queued events until none is left or drainTimeout passes.
+func (r *Recorder) drain() {
+	timeout := r.clock.After(drainTimeout)
+	for {
+		select {
+		case <-timeout:
+			r.logger.Warnf("Drop %d queued events, which are not written within %v", len(r.events), drainTimeout)
+			return
+		default:
+		}
+
+		select {
+		case event := <-r.events:
+			r.write(event)
+		default:
+			return
+		}
+	}
+}
+
+func (r *Recorder) write(event *apiv1.Event) {
+	event, key, existing := r.correlator.correlate(event)
+
+	var result *apiv1.Event
+	var err error
+	events := r.client.Events(event.Namespace)
+	if existing {
+		result, err = events.Update(event)
+		// the aggregated event may be deleted after its ttl, create a new one
+		if apierrors.IsNotFound(err) {
+			event.ResourceVersion = ""
+			result, err = events.Create(event)
+		}
+	} else {
+		result, err = events.Create(event)
+	}
+	if err != nil {
+		r.logger.Warnf("Failed to write event %s of %s/%s: %v", event.Reason, event.InvolvedObject.Namespace,
+			event.InvolvedObject.Name, err)
+		return
+	}
+	r.correlator.observe(key, result)
+}
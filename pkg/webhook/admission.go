@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The vendored client-go predates admission.k8s.io/v1beta1,
+// so AdmissionReview is described with the local types below.
+type AdmissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Request  *AdmissionRequest  `json:"request,omitempty"`
+	Response *AdmissionResponse `json:"response,omitempty"`
+}
+
+type Operation string
+
+const (
+	Create Operation = "CREATE"
+	Update Operation = "UPDATE"
+	Delete Operation = "DELETE"
+)
+
+type AdmissionRequest struct {
+	UID       types.UID               `json:"uid"`
+	Kind      metav1.GroupVersionKind `json:"kind"`
+	Namespace string                  `json:"namespace,omitempty"`
+	Name      string                  `json:"name,omitempty"`
+	Operation Operation               `json:"operation"`
+	Object    json.RawMessage         `json:"object,omitempty"`
+	OldObject json.RawMessage         `json:"oldObject,omitempty"`
+}
+
+type PatchType string
+
+const PatchTypeJSONPatch PatchType = "JSONPatch"
+
+type AdmissionResponse struct {
+	UID       types.UID      `json:"uid"`
+	Allowed   bool           `json:"allowed"`
+	Result    *metav1.Status `json:"status,omitempty"`
+	Patch     []byte         `json:"patch,omitempty"`
+	PatchType *PatchType     `json:"patchType,omitempty"`
+}
+
+// JSONPatchOp is an operation of RFC 6902 json patch.
+type JSONPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
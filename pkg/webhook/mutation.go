@@ -0,0 +1,52 @@
+package webhook
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+// newDefaultingPatch returns the json patch which sets the defaults of ws spec.
+func newDefaultingPatch(ws *v1.WebServerCluster, defaults *v1.WebServerClusterDefaults) ([]byte, error) {
+	original, err := specFields(&ws.Spec)
+	if err != nil {
+		return nil, err
+	}
+	defaulted := ws.Spec
+	if !v1.SetDefaults(&defaulted, defaults) {
+		return nil, nil
+	}
+	current, err := specFields(&defaulted)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(current))
+	for key := range current {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ops := []JSONPatchOp{}
+	for _, key := range keys {
+		if value := current[key]; !reflect.DeepEqual(original[key], value) {
+			// add replaces the member if it already exists
+			ops = append(ops, JSONPatchOp{Op: "add", Path: "/spec/" + key, Value: value})
+		}
+	}
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(ops)
+}
+
+func specFields(spec *v1.WebServerClusterSpec) (map[string]interface{}, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	return fields, json.Unmarshal(data, &fields)
+}
@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"io/ioutil"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+	"github.com/mathspanda/ws-operator-demo/pkg/k8s"
+)
+
+const (
+	WebhookConfigurationName = "ws-operator-demo"
+
+	validatingWebhookName = "validate.webserverclusters.demo.io"
+	mutatingWebhookName   = "mutate.webserverclusters.demo.io"
+)
+
+// Register creates or updates the validating and mutating webhook configurations
+// which point to the service of this server.
+func (s *Server) Register(webhookI k8s.WebhookConfigurationInterface) error {
+	caBundle, err := ioutil.ReadFile(s.config.CAFile)
+	if err != nil {
+		return err
+	}
+
+	err = webhookI.ApplyMutating(&k8s.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: WebhookConfigurationName},
+		Webhooks:   []k8s.Webhook{s.newWebhook(mutatingWebhookName, MutatePath, caBundle)},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = webhookI.ApplyValidating(&k8s.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: WebhookConfigurationName},
+		Webhooks:   []k8s.Webhook{s.newWebhook(validatingWebhookName, ValidatePath, caBundle)},
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.Info("Successfully register admission webhooks.")
+	return nil
+}
+
+func (s *Server) newWebhook(name, path string, caBundle []byte) k8s.Webhook {
+	// ignore failures so that WebServerClusters can still be managed when operator is down,
+	// the CRD validation schema covers the basic rules
+	failurePolicy := k8s.WebhookFailurePolicyIgnore
+	return k8s.Webhook{
+		Name: name,
+		ClientConfig: k8s.WebhookClientConfig{
+			Service: &k8s.ServiceReference{
+				Namespace: s.config.ServiceNamespace,
+				Name:      s.config.ServiceName,
+				Path:      &path,
+			},
+			CABundle: caBundle,
+		},
+		Rules: []k8s.RuleWithOperations{
+			{
+				Operations:  []k8s.OperationType{k8s.OperationCreate, k8s.OperationUpdate},
+				APIGroups:   []string{v1.CRDGroup},
+				APIVersions: []string{v1.CRDVersion},
+				Resources:   []string{v1.CRDPlural},
+			},
+		},
+		FailurePolicy: &failurePolicy,
+	}
+}
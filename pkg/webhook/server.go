@@ -0,0 +1,181 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+const (
+	ValidatePath = "/validate"
+	MutatePath   = "/mutate"
+)
+
+type Config struct {
+	Port     int
+	CertFile string
+	KeyFile  string
+	// CA bundle which signs the serving certificate, registered in webhook configurations
+	CAFile string
+
+	ServiceName      string
+	ServiceNamespace string
+
+	// registries images are allowed to be pulled from, empty means no restriction
+	AllowedRegistries []string
+	// defaults of WebServerCluster spec set by mutating webhook
+	Defaults *v1.WebServerClusterDefaults
+}
+
+type Server struct {
+	config *Config
+	lister ClusterLister
+
+	logger *log.Entry
+}
+
+func NewServer(config *Config, lister ClusterLister) *Server {
+	return &Server{
+		config: config,
+		lister: lister,
+		logger: log.WithField("service", "webhook"),
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ValidatePath, s.ServeValidate)
+	mux.HandleFunc(MutatePath, s.ServeMutate)
+	return mux
+}
+
+// Run serves admission webhooks over https until ctx is done.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.config.Port),
+		Handler: s.Handler(),
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	s.logger.Infof("Begin to serve admission webhooks on %s", server.Addr)
+	err := server.ListenAndServeTLS(s.config.CertFile, s.config.KeyFile)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) ServeValidate(w http.ResponseWriter, r *http.Request) {
+	s.serve(w, r, s.validate)
+}
+
+func (s *Server) ServeMutate(w http.ResponseWriter, r *http.Request) {
+	s.serve(w, r, s.mutate)
+}
+
+type admitFunc func(*AdmissionRequest, *v1.WebServerCluster) *AdmissionResponse
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, admit admitFunc) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review := &AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	req := review.Request
+	ws := &v1.WebServerCluster{}
+	var resp *AdmissionResponse
+	if err := json.Unmarshal(req.Object, ws); err != nil {
+		resp = denied(apierrors.NewBadRequest(err.Error()))
+	} else {
+		resp = admit(req, ws)
+	}
+	resp.UID = req.UID
+
+	data, err := json.Marshal(&AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: resp,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// validate validates the spec of created WebServerClusters, and of updated ones if spec changes. Updates of
+// metadata only, e.g. the finalizer writes of operator, and updates of deleting WebServerClusters are always
+// allowed, so that tightened rules never block deletion.
+func (s *Server) validate(req *AdmissionRequest, ws *v1.WebServerCluster) *AdmissionResponse {
+	if ws.DeletionTimestamp != nil {
+		return &AdmissionResponse{Allowed: true}
+	}
+	if req.Operation == Update && len(req.OldObject) > 0 {
+		old := &v1.WebServerCluster{}
+		if err := json.Unmarshal(req.OldObject, old); err != nil {
+			return denied(apierrors.NewBadRequest(err.Error()))
+		}
+		if reflect.DeepEqual(old.Spec, ws.Spec) {
+			return &AdmissionResponse{Allowed: true}
+		}
+	}
+
+	if ws.Namespace == "" {
+		ws.Namespace = req.Namespace
+	}
+	if errs := s.validateWebServerCluster(ws); len(errs) > 0 {
+		s.logger.Infof("Deny %s of WebServerCluster %s/%s: %v", req.Operation, ws.Namespace, ws.Name,
+			errs.ToAggregate())
+		return denied(apierrors.NewInvalid(schema.GroupKind{Group: v1.CRDGroup, Kind: v1.CRDKind},
+			ws.Name, errs))
+	}
+	return &AdmissionResponse{Allowed: true}
+}
+
+func (s *Server) mutate(req *AdmissionRequest, ws *v1.WebServerCluster) *AdmissionResponse {
+	patch, err := newDefaultingPatch(ws, s.config.Defaults)
+	if err != nil {
+		return denied(apierrors.NewInternalError(err))
+	}
+	if len(patch) == 0 {
+		return &AdmissionResponse{Allowed: true}
+	}
+
+	patchType := PatchTypeJSONPatch
+	return &AdmissionResponse{
+		Allowed:   true,
+		Patch:     patch,
+		PatchType: &patchType,
+	}
+}
+
+func denied(err *apierrors.StatusError) *AdmissionResponse {
+	status := err.Status()
+	return &AdmissionResponse{
+		Allowed: false,
+		Result:  &status,
+	}
+}
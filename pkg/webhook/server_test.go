@@ -0,0 +1,176 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+type fakeLister struct {
+	clusters []*v1.WebServerCluster
+}
+
+func (l *fakeLister) ListClusters() ([]*v1.WebServerCluster, error) {
+	return l.clusters, nil
+}
+
+func newTestServer(clusters ...*v1.WebServerCluster) *Server {
+	return NewServer(&Config{
+		AllowedRegistries: []string{"docker.io"},
+		Defaults:          &v1.WebServerClusterDefaults{Replicas: 1, Image: "nginx"},
+	}, &fakeLister{clusters: clusters})
+}
+
+func newCluster(namespace, name, image string, port int32) *v1.WebServerCluster {
+	return &v1.WebServerCluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1.CRDGroup + "/" + v1.CRDVersion, Kind: v1.CRDKind},
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       v1.WebServerClusterSpec{Image: image, ServicePort: port},
+	}
+}
+
+func withFinalizer(ws *v1.WebServerCluster) *v1.WebServerCluster {
+	wsCopy := *ws
+	wsCopy.Finalizers = []string{v1.WebServerClusterFinalizer}
+	return &wsCopy
+}
+
+func deleting(ws *v1.WebServerCluster) *v1.WebServerCluster {
+	wsCopy := *ws
+	now := metav1.NewTime(time.Now())
+	wsCopy.DeletionTimestamp = &now
+	return &wsCopy
+}
+
+// review posts an AdmissionReview of obj and oldObj to path, and returns the response.
+func review(t *testing.T, s *Server, path string, op Operation, obj, oldObj *v1.WebServerCluster) *AdmissionResponse {
+	req := &AdmissionRequest{
+		UID:       "uid",
+		Namespace: obj.Namespace,
+		Name:      obj.Name,
+		Operation: op,
+	}
+	var err error
+	if req.Object, err = json.Marshal(obj); err != nil {
+		t.Fatal(err)
+	}
+	if oldObj != nil {
+		if req.OldObject, err = json.Marshal(oldObj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	body, err := json.Marshal(&AdmissionReview{Request: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expect status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	result := &AdmissionReview{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Response == nil || result.Response.UID != "uid" {
+		t.Fatalf("expect response of uid, got %+v", result.Response)
+	}
+	return result.Response
+}
+
+func TestServeValidate(t *testing.T) {
+	valid := newCluster("ns1", "ws", "nginx", 32241)
+	forbidden := newCluster("ns1", "ws", "quay.io/nginx", 32241)
+	collided := newCluster("ns2", "other", "nginx", 32241)
+
+	tests := []struct {
+		name   string
+		op     Operation
+		obj    *v1.WebServerCluster
+		oldObj *v1.WebServerCluster
+		// WebServerClusters listed by the lister
+		clusters []*v1.WebServerCluster
+		allowed  bool
+	}{
+		{name: "valid create", op: Create, obj: valid, allowed: true},
+		{name: "forbidden registry", op: Create, obj: forbidden, allowed: false},
+		{name: "empty image", op: Create, obj: newCluster("ns1", "ws", "", 0), allowed: false},
+		{name: "node port collision in other namespace", op: Create, obj: valid,
+			clusters: []*v1.WebServerCluster{collided}, allowed: false},
+		{name: "finalizer only update", op: Update, obj: withFinalizer(forbidden), oldObj: forbidden,
+			allowed: true},
+		{name: "finalizer removal of deleting cluster", op: Update, obj: deleting(forbidden),
+			oldObj: withFinalizer(deleting(forbidden)), allowed: true},
+		{name: "spec update", op: Update, obj: forbidden, oldObj: valid, allowed: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := review(t, newTestServer(test.clusters...), ValidatePath, test.op, test.obj, test.oldObj)
+			if resp.Allowed != test.allowed {
+				t.Fatalf("expect allowed %v, got %+v", test.allowed, resp)
+			}
+			if !resp.Allowed && (resp.Result == nil || resp.Result.Code != http.StatusUnprocessableEntity) {
+				t.Fatalf("expect invalid status, got %+v", resp.Result)
+			}
+		})
+	}
+}
+
+func TestServeMutate(t *testing.T) {
+	replicas := int32(3)
+	defaulted := newCluster("ns1", "ws", "docker.io/nginx", 80)
+	defaulted.Spec.Replicas = &replicas
+
+	tests := []struct {
+		name   string
+		op     Operation
+		obj    *v1.WebServerCluster
+		oldObj *v1.WebServerCluster
+		patch  string
+	}{
+		{name: "defaults", op: Create, obj: newCluster("ns1", "ws", "", 80),
+			patch: `[{"op":"add","path":"/spec/image","value":"nginx"}]`},
+		{name: "nothing to default", op: Create, obj: defaulted},
+		{name: "finalizer only update", op: Update, obj: withFinalizer(defaulted), oldObj: defaulted},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := review(t, newTestServer(), MutatePath, test.op, test.obj, test.oldObj)
+			if !resp.Allowed {
+				t.Fatalf("expect allowed, got %+v", resp)
+			}
+			if string(resp.Patch) != test.patch {
+				t.Fatalf("expect patch %s, got %s", test.patch, resp.Patch)
+			}
+			if test.patch != "" && (resp.PatchType == nil || *resp.PatchType != PatchTypeJSONPatch) {
+				t.Fatalf("expect JSONPatch, got %v", resp.PatchType)
+			}
+		})
+	}
+}
+
+func TestServeInvalidRequest(t *testing.T) {
+	s := newTestServer()
+
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ValidatePath, nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expect status 405, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ValidatePath, bytes.NewReader([]byte("{}"))))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expect status 400, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/mathspanda/ws-operator-demo/pkg/apis/demo.io/v1"
+)
+
+// ClusterLister lists the WebServerClusters of all namespaces, as node ports are cluster-wide.
+type ClusterLister interface {
+	ListClusters() ([]*v1.WebServerCluster, error)
+}
+
+func (s *Server) validateWebServerCluster(ws *v1.WebServerCluster) field.ErrorList {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	if ws.Spec.Replicas != nil && *ws.Spec.Replicas < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("replicas"), *ws.Spec.Replicas,
+			"must be greater than or equal to 0"))
+	}
+	allErrs = append(allErrs, s.validateImage(ws.Spec.Image, specPath.Child("image"))...)
+	allErrs = append(allErrs, s.validatePort(ws, specPath.Child("port"))...)
+	allErrs = append(allErrs, validatePorts(ws.Spec.Ports, specPath.Child("ports"))...)
+	allErrs = append(allErrs, validateService(&ws.Spec, specPath.Child("service"))...)
+
+	return allErrs
+}
+
+func (s *Server) validateImage(image string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if image == "" {
+		return append(allErrs, field.Required(fldPath, ""))
+	}
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath, image, err.Error()))
+	}
+	if len(s.config.AllowedRegistries) == 0 {
+		return allErrs
+	}
+
+	registry := reference.Domain(named)
+	for _, allowed := range s.config.AllowedRegistries {
+		if registry == allowed {
+			return allErrs
+		}
+	}
+	return append(allErrs, field.Forbidden(fldPath,
+		fmt.Sprintf("registry %s is not allowed, allowed registries: %v", registry, s.config.AllowedRegistries)))
+}
+
+func (s *Server) validatePort(ws *v1.WebServerCluster, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	port := ws.Spec.ServicePort
+	if port < 0 || port > 65535 {
+		return append(allErrs, field.Invalid(fldPath, port, "must be between 0 and 65535"))
+	}
+	nodePort := ws.Spec.NodePort()
+	if nodePort == 0 || s.lister == nil {
+		return allErrs
+	}
+
+	clusters, err := s.lister.ListClusters()
+	if err != nil {
+		return append(allErrs, field.InternalError(fldPath, err))
+	}
+	for _, other := range clusters {
+		if other.Namespace == ws.Namespace && other.Name == ws.Name {
+			continue
+		}
+		if other.Spec.NodePort() == nodePort {
+			allErrs = append(allErrs, field.Invalid(fldPath, nodePort,
+				fmt.Sprintf("node port is already used by WebServerCluster %s/%s", other.Namespace, other.Name)))
+		}
+	}
+	return allErrs
+}
+
+func validatePorts(ports []v1.WebServerClusterPort, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := map[string]bool{}
+	containerPorts := map[string]bool{}
+	servicePorts := map[string]bool{}
+
+	for i, port := range ports {
+		idxPath := fldPath.Index(i)
+		if port.Name == "" && len(ports) > 1 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"),
+				"is required when there are multiple ports"))
+		}
+		if port.Name != "" {
+			if names[port.Name] {
+				allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), port.Name))
+			}
+			names[port.Name] = true
+		}
+		if port.ContainerPort < 1 || port.ContainerPort > 65535 {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("containerPort"), port.ContainerPort,
+				"must be between 1 and 65535"))
+		}
+		if port.ServicePort < 0 || port.ServicePort > 65535 {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("servicePort"), port.ServicePort,
+				"must be between 1 and 65535"))
+		}
+		if strings.ContainsAny(port.AppProtocol, ",=") {
+			allErrs = append(allErrs, field.Invalid(idxPath.Child("appProtocol"), port.AppProtocol,
+				"must not contain ',' or '='"))
+		}
+	}
+
+	spec := &v1.WebServerClusterSpec{Ports: ports}
+	for i, port := range spec.ClusterPorts() {
+		idxPath := fldPath.Index(i)
+		containerPort := fmt.Sprintf("%d/%s", port.ContainerPort, port.Protocol)
+		if containerPorts[containerPort] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("containerPort"), port.ContainerPort))
+		}
+		containerPorts[containerPort] = true
+		servicePort := fmt.Sprintf("%d/%s", port.ServicePort, port.Protocol)
+		if servicePorts[servicePort] {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("servicePort"), port.ServicePort))
+		}
+		servicePorts[servicePort] = true
+	}
+	return allErrs
+}
+
+func validateService(spec *v1.WebServerClusterSpec, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	svcSpec := spec.Service
+	if svcSpec == nil {
+		return allErrs
+	}
+
+	svcType := spec.ServiceType()
+	switch svcType {
+	case v1.ServiceTypeClusterIP, v1.ServiceTypeHeadless, v1.ServiceTypeNodePort, v1.ServiceTypeLoadBalancer:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("type"), svcType, []string{
+			string(v1.ServiceTypeClusterIP), string(v1.ServiceTypeHeadless),
+			string(v1.ServiceTypeNodePort), string(v1.ServiceTypeLoadBalancer),
+		}))
+	}
+
+	exposed := svcType == v1.ServiceTypeNodePort || svcType == v1.ServiceTypeLoadBalancer
+	if svcSpec.NodePort != 0 && !exposed {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("nodePort"),
+			"may only be used when type is NodePort or LoadBalancer"))
+	}
+	if svcSpec.ExternalTrafficPolicy != "" && !exposed {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("externalTrafficPolicy"),
+			"may only be used when type is NodePort or LoadBalancer"))
+	}
+	if len(svcSpec.LoadBalancerSourceRanges) > 0 && svcType != v1.ServiceTypeLoadBalancer {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("loadBalancerSourceRanges"),
+			"may only be used when type is LoadBalancer"))
+	}
+	for i, cidr := range svcSpec.LoadBalancerSourceRanges {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("loadBalancerSourceRanges").Index(i),
+				cidr, "must be a CIDR"))
+		}
+	}
+	return allErrs
+}